@@ -0,0 +1,354 @@
+package lsa
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func stringToC(AText string) (string, error) {
+	var (
+		lexems *TLexem
+		sd     TSyntaxDescriptor
+		E      error
+		B      bytes.Buffer
+	)
+	if lexems, E = stringToLexems(AText); E != nil {
+		return "", E
+	}
+	if sd, E = TranslateCode(lexems); E != nil {
+		return "", E
+	}
+	if E = GenerateC(&sd, &B); E != nil {
+		return "", E
+	}
+	return B.String(), nil
+}
+
+func TestGenerateFunction(t *testing.T) {
+	S, E := stringToC(
+		"функция Наибольшее(А, Б: целый): целый\n" +
+			"переменные Результат: целый\n" +
+			"начало\n" +
+			"  если А > Б начало Результат = А конец\n" +
+			"  иначе Результат = Б\n" +
+			"конец\n" +
+			"function main\n" +
+			"var Счётчик: int, Имя: строка\n" +
+			"begin\n" +
+			"  Счётчик = 0\n" +
+			"  Имя = \"Привет \\\\ \"\n" +
+			"  while Счётчик < 10 begin\n" +
+			"    Счётчик = (Счётчик + 1) * 2\n" +
+			"  end\n" +
+			"end\n")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	standard := "/* Сгенерировано lsa */\n" +
+		"#include <stdbool.h>\n" +
+		"#include <stdint.h>\n" +
+		"\n" +
+		"int Naibolshee(int A, int B);\n" +
+		"void main_2(void);\n" +
+		"\n" +
+		"int Naibolshee(int A, int B)\n" +
+		"{\n" +
+		"\tint Rezultat;\n" +
+		"\tif (A > B)\n" +
+		"\t{\n" +
+		"\t\tRezultat = A;\n" +
+		"\t}\n" +
+		"\telse\n" +
+		"\t{\n" +
+		"\t\tRezultat = B;\n" +
+		"\t}\n" +
+		"\treturn Rezultat;\n" +
+		"}\n" +
+		"\n" +
+		"void main_2(void)\n" +
+		"{\n" +
+		"\tint Schyotchik;\n" +
+		"\tconst char *Imya;\n" +
+		"\tSchyotchik = 0;\n" +
+		"\tImya = \"Привет \\\\ \";\n" +
+		"\twhile (Schyotchik < 10)\n" +
+		"\t{\n" +
+		"\t\tSchyotchik = (Schyotchik + 1) * 2;\n" +
+		"\t}\n" +
+		"}\n" +
+		"\n" +
+		"int main(void)\n" +
+		"{\n" +
+		"\tmain_2();\n" +
+		"\treturn 0;\n" +
+		"}\n"
+
+	if S != standard {
+		t.Fatalf("Получено:\n%s\nожидается:\n%s", S, standard)
+	}
+}
+
+func TestGenerateProgram(t *testing.T) {
+	S, E := stringToC(
+		"переменные Икс, икс: двойной\n" +
+			"Икс = 1\n" +
+			"икс = Икс <> 2\n")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	standard := "/* Сгенерировано lsa */\n" +
+		"#include <stdbool.h>\n" +
+		"#include <stdint.h>\n" +
+		"\n" +
+		"double Iks;\n" +
+		"double iks;\n" +
+		"\n" +
+		"int main(void)\n" +
+		"{\n" +
+		"\tIks = 1;\n" +
+		"\tiks = Iks != 2;\n" +
+		"\treturn 0;\n" +
+		"}\n"
+
+	if S != standard {
+		t.Fatalf("Получено:\n%s\nожидается:\n%s", S, standard)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	_, E := stringToC("функция А начало функция Б начало конец конец")
+	if !errors.Is(E, EGenNestedFunction) {
+		t.Fatalf("Ожидается ошибка EGenNestedFunction, получено: %v", E)
+	}
+}
+
+func TestGenerateExpression(t *testing.T) {
+	S, E := stringToC("А = (1 + 2) * 3 - (4 - 5) + не (6 < 7)")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	if !strings.Contains(S, "\tA = (1 + 2) * 3 - (4 - 5) + !(6 < 7);\n") {
+		t.Fatalf("Неправильное выражение:\n%s", S)
+	}
+}
+
+func Test_cName(t *testing.T) {
+	var G TCGenerator
+	G.Init()
+
+	names := []struct{ L, C string }{
+		{"Длина окружности", "Dlina_okruzhnosti"},
+		{"Diameter of the circle", "Diameter_of_the_circle"},
+		{"Длина окружности", "Dlina_okruzhnosti"},
+		{"int", "int_2"},
+		{"Щука", "Shchuka"},
+		{"Sчётчик", "Schyotchik"},
+		{"Счётчик", "Schyotchik_2"},
+	}
+
+	for _, N := range names {
+		if S := G.cName(N.L); S != N.C {
+			t.Errorf("Имя '%s' переведено в '%s', ожидается '%s'", N.L, S, N.C)
+		}
+	}
+}
+
+func TestGenerateCall(t *testing.T) {
+	S, E := stringToC(
+		"функция Квадрат(Х: двойной): двойной начало вернуть Х * Х конец\n" +
+			"функция Точка.Сдвинуть(Д: целый) начало конец\n" +
+			"переменные Икс: двойной\n" +
+			"Икс = Квадрат(Квадрат(2) + 1) * 3\n" +
+			"Точка.Сдвинуть(1)\n")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	if !strings.Contains(S, "\tIks = Kvadrat(Kvadrat(2) + 1) * 3;\n") ||
+		!strings.Contains(S, "\tTochka_Sdvinut(1);\n") ||
+		!strings.Contains(S, "void Tochka_Sdvinut(int D);\n") {
+		t.Fatalf("Неправильный вызов функции:\n%s", S)
+	}
+}
+
+func TestGenerateNumbers(t *testing.T) {
+	S, E := stringToC("А = 0x10 + 1_000 * 2.50 - 18446744073709551615")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	if !strings.Contains(S, "\tA = 16 + 1000 * 2.5 - 18446744073709551615ULL;\n") {
+		t.Fatalf("Неправильное выражение:\n%s", S)
+	}
+
+	_, E = stringToC("А = 18446744073709551616")
+	if !errors.Is(E, EGenNumberTooBig) {
+		t.Fatalf("Ожидается ошибка EGenNumberTooBig, получено: %v", E)
+	}
+}
+
+func TestGenerateEscapes(t *testing.T) {
+	S, E := stringToC(
+		"переменные С: строка, Б: символ\n" +
+			"С = \"\\\"да\\\" \\\\ \\u{44F}\\t\\x01\"\n" +
+			"Б = '\\''\n" +
+			"Б = 'я'\n" +
+			"С = \"\\xFF\\xD0\\xAF\"\n" +
+			"Б = '\\xFF'\n")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	if !strings.Contains(S, "\tS = \"\\\"да\\\" \\\\ я\\t\\001\";\n") ||
+		!strings.Contains(S, "\tB = '\\'';\n") ||
+		!strings.Contains(S, "\tB = 1103;\n") ||
+		!strings.Contains(S, "\tS = \"\\377Я\";\n") ||
+		!strings.Contains(S, "\tB = 255;\n") ||
+		!strings.Contains(S, "\nint32_t B;\n") {
+		t.Fatalf("Неправильные константы:\n%s", S)
+	}
+}
+
+func TestGenerateLogicalOperations(t *testing.T) {
+	S, E := stringToC(
+		"переменные А, Б: целый, В: булев\n" +
+			"В = А < 1 или Б > 2 и не В\n" +
+			"В = А искл Б = 2\n" +
+			"А = (А & 7 | Б ~ 1) % 3 сдвл 2\n" +
+			"А = (А + Б) & 0xFF\n" +
+			"А = 2 ^ А ^ (Б + 1) * 3\n")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	lines := []string{
+		"#include <math.h>\n",
+		"\tV = A < 1 || (B > 2 && !V);\n",
+		"\tV = !A != !(B == 2);\n",
+		"\tA = ((((A & 7) | B) ^ 1) % 3) << 2;\n",
+		"\tA = (A + B) & 255;\n",
+		"\tA = pow(2, pow(A, B + 1)) * 3;\n",
+	}
+	for _, L := range lines {
+		if !strings.Contains(S, L) {
+			t.Errorf("Нет строки %q в тексте:\n%s", L, S)
+		}
+	}
+
+	// math.h подключается, только если есть возведение в степень
+	if S, E = stringToC("А = 1 % 2"); E != nil || strings.Contains(S, "math.h") {
+		t.Errorf("Лишний math.h: %v\n%s", E, S)
+	}
+}
+
+func TestGenerateUnaryOperations(t *testing.T) {
+	S, E := stringToC(
+		"переменные А, Б: целый\n" +
+			"А = -5 + +Б\n" +
+			"А = -(А + Б) - -Б\n" +
+			"А = - -А\n" +
+			"А = ~Б & -0x10\n" +
+			"А = -9223372036854775808\n")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	lines := []string{
+		"\tA = -5 + +B;\n",
+		"\tA = -(A + B) - -B;\n",
+		"\tA = -(-A);\n",
+		"\tA = ~B & -16;\n",
+		"\tA = INT64_MIN;\n",
+	}
+	for _, L := range lines {
+		if !strings.Contains(S, L) {
+			t.Errorf("Нет строки %q в тексте:\n%s", L, S)
+		}
+	}
+}
+
+func TestGenerateReturn(t *testing.T) {
+	S, E := stringToC(
+		"функция Модуль(Х: целый): целый\n" +
+			"начало\n" +
+			"  если Х < 0 начало вернуть -Х конец\n" +
+			"  иначе вернуть Х\n" +
+			"конец\n" +
+			"function Sign(X: int): int\n" +
+			"begin\n" +
+			"  Result = 0\n" +
+			"  if X > 0 begin результат = 1; return end\n" +
+			"  if X < 0 begin RESULT = -1 end\n" +
+			"end\n" +
+			"процедура Печать(Х: целый) начало если Х вернуть конец\n")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	lines := []string{
+		"int Modul(int H)\n{\n\tif (H < 0)\n\t{\n\t\treturn -H;\n\t}\n" +
+			"\telse\n\t{\n\t\treturn H;\n\t}\n}\n",
+		"int Sign(int X)\n{\n\tint rezultat;\n\trezultat = 0;\n",
+		"\t\trezultat = 1;\n\t\treturn rezultat;\n",
+		"\t\trezultat = -1;\n\t}\n\treturn rezultat;\n}\n",
+		"void Pechat(int H)\n{\n\tif (H)\n\t{\n\t\treturn;\n\t}\n}\n",
+	}
+	for _, L := range lines {
+		if !strings.Contains(S, L) {
+			t.Errorf("Нет текста %q в тексте:\n%s", L, S)
+		}
+	}
+}
+
+func TestGenerateFor(t *testing.T) {
+	S, E := stringToC(
+		"функция Сумма(Н: целый): целый\n" +
+			"переменные И: целый\n" +
+			"начало\n" +
+			"  результат = 0\n" +
+			"  для И от 1 до Н\n    результат += И\n" +
+			"  для И = Н вниз до 0 шаг 2 начало результат -= И конец\n" +
+			"  for И := 0 to Н * 2 step Н { }\n" +
+			"  for И = 5 downto 1 { вернуть }\n" +
+			"конец\n")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	lines := []string{
+		"\tfor (I = 1; I <= N; I++)\n\t{\n\t\trezultat = rezultat + I;\n\t}\n",
+		"\tfor (I = N; I >= 0; I -= 2)\n\t{\n\t\trezultat = rezultat - I;\n\t}\n",
+		"\tfor (I = 0; I <= N * 2; I += N)\n\t{\n\t}\n",
+		"\tfor (I = 5; I >= 1; I--)\n\t{\n\t\treturn rezultat;\n\t}\n",
+	}
+	for _, L := range lines {
+		if !strings.Contains(S, L) {
+			t.Errorf("Нет текста %q в тексте:\n%s", L, S)
+		}
+	}
+}
+
+func TestGenerateRepeat(t *testing.T) {
+	S, E := stringToC(
+		"функция Ф(Н: целый): целый\n" +
+			"начало\n" +
+			"  повторять\n    Н = Н - 1\n  до Н < 0 или Н == 5\n" +
+			"  do { Н = Н * 2 } while Н < 100\n" +
+			"  повторять\n    результат = Н\n  до 1\n" +
+			"конец\n")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	lines := []string{
+		"\tdo\n\t{\n\t\tN = N - 1;\n\t}\n\twhile (!(N < 0 || N == 5));\n",
+		"\tdo\n\t{\n\t\tN = N * 2;\n\t}\n\twhile (N < 100);\n",
+		"\tdo\n\t{\n\t\trezultat = N;\n\t}\n\twhile (!1);\n",
+	}
+	for _, L := range lines {
+		if !strings.Contains(S, L) {
+			t.Errorf("Нет текста %q в тексте:\n%s", L, S)
+		}
+	}
+}
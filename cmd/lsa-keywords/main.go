@@ -0,0 +1,75 @@
+/*
+ Переписывает тексты программ на языке L к одному набору зарезервированных
+ слов:
+   lsa-keywords -to русский файл.l          результат в стандартный вывод
+   lsa-keywords -to english -w *.l          файлы переписываются на месте
+   lsa-keywords -set школа.txt -to школьный файл.l
+ Без файлов текст читается из стандартного ввода.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/biorhitm/lsa"
+)
+
+func main() {
+	target := flag.String("to", "", "название набора слов, например русский или english")
+	setFile := flag.String("set", "", "файл с дополнительным набором слов")
+	write := flag.Bool("w", false, "записать результат в исходный файл")
+	flag.Parse()
+
+	if *setFile != "" {
+		set, E := lsa.LoadKeywordSetFile(*setFile)
+		if E != nil {
+			fail(*setFile, E)
+		}
+		lsa.RegisterKeywordSet(set)
+	}
+	set := lsa.KeywordSetByName(*target)
+	if set == nil {
+		fmt.Fprintf(os.Stderr, "lsa-keywords: неизвестный набор слов %q\n", *target)
+		os.Exit(2)
+	}
+
+	if flag.NArg() == 0 {
+		data, E := io.ReadAll(os.Stdin)
+		if E != nil {
+			fail("stdin", E)
+		}
+		result, E := lsa.ConvertKeywords(data, set)
+		if E != nil {
+			fail("stdin", E)
+		}
+		os.Stdout.Write(result)
+		return
+	}
+
+	for _, name := range flag.Args() {
+		data, E := os.ReadFile(name)
+		if E != nil {
+			fail(name, E)
+		}
+		result, E := lsa.ConvertKeywords(data, set)
+		if E != nil {
+			fail(name, E)
+		}
+		if *write {
+			E = os.WriteFile(name, result, 0666)
+		} else {
+			_, E = os.Stdout.Write(result)
+		}
+		if E != nil {
+			fail(name, E)
+		}
+	}
+}
+
+func fail(AName string, E error) {
+	fmt.Fprintf(os.Stderr, "lsa-keywords: %s: %v\n", AName, E)
+	os.Exit(1)
+}
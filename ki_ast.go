@@ -0,0 +1,296 @@
+package lsa
+
+// Синтаксическое дерево программы на языке L. Строится функцией
+// TranslateCode одновременно со списком элементов языка.
+
+// Положение в тексте программы, номера строк и колонок начинаются с 0
+type TPosition struct {
+	LineNo   uint `json:"line"`
+	ColumnNo uint `json:"column"`
+	// номер колонки в кодовых единицах UTF-16
+	Column16 uint `json:"column16"`
+	// смещение в байтах от начала текста
+	Offset uint64 `json:"offset"`
+}
+
+// Участок текста программы, End указывает на первый символ после участка
+type TSpan struct {
+	Start TPosition `json:"start"`
+	End   TPosition `json:"end"`
+}
+
+type TNode interface {
+	Position() TPosition
+	Span() TSpan
+}
+
+// Выражение
+type TExpr interface {
+	TNode
+	exprNode()
+}
+
+// Оператор
+type TStmt interface {
+	TNode
+	stmtNode()
+}
+
+type TNodeBase struct {
+	Pos TPosition
+	// положение после последней лексемы узла
+	End TPosition
+}
+
+func (self *TNodeBase) Position() TPosition {
+	return self.Pos
+}
+
+func (self *TNodeBase) Span() TSpan {
+	return TSpan{Start: self.Pos, End: self.End}
+}
+
+// Идентификатор, возможно состоящий из нескольких слов: "Длина окружности"
+type TIdent struct {
+	TNodeBase
+	Name string
+}
+
+// Константа: число, строка или символ
+type TLiteral struct {
+	TNodeBase
+	// ltitNumber, ltitString или ltitChar
+	Kind  TLanguageItemType
+	Value string
+	// значение числовой константы
+	Number TNumberValue
+}
+
+// Унарная операция: не X, &X
+type TUnaryExpr struct {
+	TNodeBase
+	Op TLanguageItemType
+	X  TExpr
+}
+
+// Бинарная операция: X + Y, X <> Y
+type TBinaryExpr struct {
+	TNodeBase
+	Op TLanguageItemType
+	X  TExpr
+	Y  TExpr
+}
+
+// Вызов функции: Синус(Угол), Объект.Метод(А, Б)
+type TCallExpr struct {
+	TNodeBase
+	// nil, если вызывается не метод объекта
+	Object *TIdent
+	Func   *TIdent
+	Args   []TExpr
+}
+
+// Тип данных: [<ИМЯ ПАКЕТА> '.']<ИДЕНТИФИКАТОР>
+type TTypeRef struct {
+	TNodeBase
+	// nil, если пакет не указан
+	Package *TIdent
+	Name    *TIdent
+}
+
+// Группа переменных или параметров одного типа: А, Б, В: целый
+type TVarSpec struct {
+	TNodeBase
+	Names []*TIdent
+	Type  *TTypeRef
+}
+
+// Список переменных: переменные А, Б: целый, С: строка
+type TVarDecl struct {
+	TNodeBase
+	Specs []*TVarSpec
+}
+
+// Объявление функции
+type TFuncDecl struct {
+	TNodeBase
+	// nil, если функция не является членом класса
+	Class  *TIdent
+	Name   *TIdent
+	Params []*TVarSpec
+	// nil, если функция не возвращает результат
+	Result *TTypeRef
+	// объявлена словом 'процедура', не может иметь результата
+	Procedure bool
+	// nil, если нет локальных переменных
+	Vars *TVarDecl
+	Body TStmt
+}
+
+// Присваивание: <ИДЕНТИФИКАТОР> = <ВЫРАЖЕНИЕ>
+type TAssignStmt struct {
+	TNodeBase
+	Target *TIdent
+	Value  TExpr
+}
+
+// Вызов функции, записанный отдельным оператором
+type TCallStmt struct {
+	TNodeBase
+	Call *TCallExpr
+}
+
+// Операторы в программных скобках 'начало' 'конец'
+type TBlockStmt struct {
+	TNodeBase
+	List []TStmt
+}
+
+type TIfStmt struct {
+	TNodeBase
+	Cond TExpr
+	Then TStmt
+	// nil, если нет ветки 'иначе'
+	Else TStmt
+}
+
+type TWhileStmt struct {
+	TNodeBase
+	Cond TExpr
+	Body TStmt
+}
+
+// Цикл со счётчиком: для И от 1 до 10 шаг 2
+type TForStmt struct {
+	TNodeBase
+	Var  *TIdent
+	From TExpr
+	To   TExpr
+	// nil, если шаг не указан и равен 1
+	Step TExpr
+	// цикл 'вниз до': счётчик уменьшается на шаг
+	Down bool
+	Body TStmt
+}
+
+// Цикл с условием после тела: повторять ... до А > 10
+type TRepeatStmt struct {
+	TNodeBase
+	Body TStmt
+	Cond TExpr
+	// цикл 'до' повторяется, пока условие ложно, цикл 'пока' — пока истинно
+	Until bool
+}
+
+// Возврат из функции: вернуть [<ВЫРАЖЕНИЕ>]
+type TReturnStmt struct {
+	TNodeBase
+	// nil, если значение не указано
+	Result TExpr
+}
+
+// Программа: объявления функций, переменных и операторы вне функций
+type TProgram struct {
+	TNodeBase
+	List []TStmt
+}
+
+func (*TIdent) exprNode()      {}
+func (*TLiteral) exprNode()    {}
+func (*TUnaryExpr) exprNode()  {}
+func (*TBinaryExpr) exprNode() {}
+func (*TCallExpr) exprNode()   {}
+
+func (*TVarDecl) stmtNode()    {}
+func (*TFuncDecl) stmtNode()   {}
+func (*TAssignStmt) stmtNode() {}
+func (*TCallStmt) stmtNode()   {}
+func (*TBlockStmt) stmtNode()  {}
+func (*TIfStmt) stmtNode()     {}
+func (*TWhileStmt) stmtNode()  {}
+func (*TReturnStmt) stmtNode() {}
+func (*TForStmt) stmtNode()    {}
+func (*TRepeatStmt) stmtNode() {}
+
+/*
+ Обходит дерево, начиная с узла N, и вызывает AVisit для каждого узла.
+ Если AVisit возвращает ложь, то вложенные узлы не обходятся.
+*/
+func walkNode(N TNode, AVisit func(TNode) bool) {
+	if N == nil || !AVisit(N) {
+		return
+	}
+	walkList := func(AList []TStmt) {
+		for _, S := range AList {
+			walkNode(S, AVisit)
+		}
+	}
+
+	switch X := N.(type) {
+	case *TUnaryExpr:
+		walkNode(X.X, AVisit)
+	case *TBinaryExpr:
+		walkNode(X.X, AVisit)
+		walkNode(X.Y, AVisit)
+	case *TCallExpr:
+		if X.Object != nil {
+			walkNode(X.Object, AVisit)
+		}
+		for _, A := range X.Args {
+			walkNode(A, AVisit)
+		}
+	case *TAssignStmt:
+		walkNode(X.Target, AVisit)
+		walkNode(X.Value, AVisit)
+	case *TCallStmt:
+		walkNode(X.Call, AVisit)
+	case *TBlockStmt:
+		walkList(X.List)
+	case *TIfStmt:
+		walkNode(X.Cond, AVisit)
+		walkNode(X.Then, AVisit)
+		if X.Else != nil {
+			walkNode(X.Else, AVisit)
+		}
+	case *TWhileStmt:
+		walkNode(X.Cond, AVisit)
+		walkNode(X.Body, AVisit)
+	case *TForStmt:
+		walkNode(X.Var, AVisit)
+		walkNode(X.From, AVisit)
+		walkNode(X.To, AVisit)
+		if X.Step != nil {
+			walkNode(X.Step, AVisit)
+		}
+		walkNode(X.Body, AVisit)
+	case *TRepeatStmt:
+		walkNode(X.Body, AVisit)
+		walkNode(X.Cond, AVisit)
+	case *TReturnStmt:
+		if X.Result != nil {
+			walkNode(X.Result, AVisit)
+		}
+	case *TFuncDecl:
+		walkNode(X.Body, AVisit)
+	case *TProgram:
+		walkList(X.List)
+	}
+}
+
+func (self *TLexem) Position() TPosition {
+	return self.Span.Start
+}
+
+// Возвращает копию ошибки E с этим положением, сама E не изменяется
+func (self TPosition) errorAt(E *lsaError) error {
+	return self.newError(E)
+}
+
+func (self TPosition) newError(E *lsaError) *lsaError {
+	C := *E
+	C.LineNo = self.LineNo
+	C.ColumnNo = self.ColumnNo
+	C.Offset = self.Offset
+	C.Span = TSpan{Start: self, End: self}
+	return &C
+}
@@ -0,0 +1,820 @@
+package lsa
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Генератор текста программы на языке СИ(C99) по синтаксическому дереву,
+// полученному от TranslateCode.
+//
+// Глобальные переменные, прототипы и тела функций собираются в отдельные
+// буферы, а операторы, записанные вне функций, попадают в тело функции main.
+type TCGenerator struct {
+	// имена на языке L и соответствующие им имена на языке СИ
+	Names map[string]string
+	// уже занятые имена на языке СИ
+	UsedNames map[string]bool
+
+	Globals    bytes.Buffer
+	Prototypes bytes.Buffer
+	Functions  bytes.Buffer
+	MainBody   bytes.Buffer
+
+	// имя функции, которую надо вызвать из main, если вне функций нет
+	// ни одного оператора
+	MainFunction string
+	// в программе есть возведение в степень, нужен math.h
+	UsesMath bool
+	// имя на СИ переменной результата переводимой функции
+	result string
+}
+
+type TCDataType struct {
+	Name  string
+	CName string
+}
+
+var (
+	cDataTypeList = []TCDataType{
+		{"целый", "int"},
+		{"целое", "int"},
+		{"int", "int"},
+		{"integer", "int"},
+		{"Int64", "int64_t"},
+		{"плавающий", "float"},
+		{"float", "float"},
+		{"двойной", "double"},
+		{"double", "double"},
+		{"строка", "const char *"},
+		{"string", "const char *"},
+		{"булев", "bool"},
+		{"булевый", "bool"},
+		{"bool", "bool"},
+		// символ хранит номер символа Unicode, а не байт
+		{"символ", "int32_t"},
+		{"char", "int32_t"},
+	}
+
+	// имена функций, которые будут вызваны из main
+	mainFunctionNames = []string{"главная", "main"}
+
+	// слова, которые нельзя использовать как имена в программе на СИ
+	cReservedWords = []string{
+		"auto", "break", "case", "char", "const", "continue", "default", "do",
+		"double", "else", "enum", "extern", "float", "for", "goto", "if",
+		"inline", "int", "long", "register", "restrict", "return", "short",
+		"signed", "sizeof", "static", "struct", "switch", "typedef", "union",
+		"unsigned", "void", "volatile", "while", "_Bool", "_Complex",
+		"_Imaginary", "bool", "true", "false", "main",
+	}
+
+	cyrillicToLatin = map[rune]string{
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+		'ж': "zh", 'з': "z", 'и': "i", 'й': "j", 'к': "k", 'л': "l", 'м': "m",
+		'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+		'ф': "f", 'х': "h", 'ц': "c", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+		'ъ': "", 'ы': "y", 'ь': "", 'э': "eh", 'ю': "yu", 'я': "ya",
+		'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Д': "D", 'Е': "E", 'Ё': "Yo",
+		'Ж': "Zh", 'З': "Z", 'И': "I", 'Й': "J", 'К': "K", 'Л': "L", 'М': "M",
+		'Н': "N", 'О': "O", 'П': "P", 'Р': "R", 'С': "S", 'Т': "T", 'У': "U",
+		'Ф': "F", 'Х': "H", 'Ц': "C", 'Ч': "Ch", 'Ш': "Sh", 'Щ': "Shch",
+		'Ъ': "", 'Ы': "Y", 'Ь': "", 'Э': "Eh", 'Ю': "Yu", 'Я': "Ya",
+	}
+)
+
+// ошибки генерации
+var (
+	EGenNestedFunction   = newError("E301")
+	EGenUnknownNode      = newError("E302")
+	EGenUnknownOperation = newError("E303")
+	EGenNumberTooBig     = newError("E304")
+)
+
+/*
+ Формирует по синтаксическому дереву текст программы на языке СИ и
+ записывает его в AWriter
+*/
+func GenerateC(ASD *TSyntaxDescriptor, AWriter io.Writer) error {
+	var G TCGenerator
+	G.Init()
+
+	if E := G.generateProgram(ASD.Program); E != nil {
+		return E
+	}
+
+	return G.writeTo(AWriter)
+}
+
+func (self *TCGenerator) Init() {
+	self.Names = make(map[string]string)
+	self.UsedNames = make(map[string]bool)
+	for _, S := range cReservedWords {
+		self.UsedNames[S] = true
+	}
+	self.MainFunction = ""
+	self.UsesMath = false
+}
+
+// Возвращает имя на языке СИ для имени AName на языке L. Каждое новое
+// имя транслитерируется, пробелы заменяются на '_'; если такое имя
+// уже занято, то к нему добавляется номер.
+func (self *TCGenerator) cName(AName string) string {
+	if S, ok := self.Names[AName]; ok {
+		return S
+	}
+
+	var B strings.Builder
+	for _, C := range AName {
+		switch {
+		case C == ' ':
+			B.WriteRune('_')
+		case C == '_' || isDigit(C) || ('A' <= C && C <= 'Z') ||
+			('a' <= C && C <= 'z'):
+			B.WriteRune(C)
+		default:
+			if S, ok := cyrillicToLatin[C]; ok {
+				B.WriteString(S)
+			} else {
+				fmt.Fprintf(&B, "_u%04X", C)
+			}
+		}
+	}
+
+	base := B.String()
+	if base == "" {
+		base = "_"
+	}
+	S := base
+	for i := 2; self.UsedNames[S]; i++ {
+		S = base + "_" + strconv.Itoa(i)
+	}
+
+	self.UsedNames[S] = true
+	self.Names[AName] = S
+	return S
+}
+
+// Возвращает тип данных на языке СИ
+func (self *TCGenerator) cDataType(T *TTypeRef) string {
+	for _, D := range cDataTypeList {
+		if D.Name == T.Name.Name {
+			return D.CName
+		}
+	}
+
+	if T.Package != nil {
+		return self.cName(T.Package.Name + " " + T.Name.Name)
+	}
+	return self.cName(T.Name.Name)
+}
+
+// Формирует объявление переменной, для указателей звёздочка прижимается
+// к имени: "const char *s"
+func cDeclaration(AType, AName string) string {
+	if strings.HasSuffix(AType, "*") {
+		return AType + AName
+	}
+	return AType + " " + AName
+}
+
+// Переводит список переменных, каждая переменная объявляется отдельной
+// строкой
+func (self *TCGenerator) generateVarDecl(W *bytes.Buffer, V *TVarDecl,
+	AIndent string) {
+	for _, spec := range V.Specs {
+		cType := self.cDataType(spec.Type)
+		for _, name := range spec.Names {
+			fmt.Fprintf(W, "%s%s;\n", AIndent,
+				cDeclaration(cType, self.cName(name.Name)))
+		}
+	}
+}
+
+func (self *TCGenerator) generateFunction(F *TFuncDecl) error {
+	params := make([]string, 0, 8)
+	for _, spec := range F.Params {
+		cType := self.cDataType(spec.Type)
+		for _, name := range spec.Names {
+			params = append(params, cDeclaration(cType, self.cName(name.Name)))
+		}
+	}
+
+	result := "void"
+	if F.Result != nil {
+		result = self.cDataType(F.Result)
+	}
+
+	fullName := F.Name.Name
+	if F.Class != nil {
+		fullName = F.Class.Name + " " + F.Name.Name
+	}
+	cName := self.cName(fullName)
+	if F.Class == nil && len(params) == 0 {
+		for _, S := range mainFunctionNames {
+			if S == F.Name.Name {
+				self.MainFunction = cName
+			}
+		}
+	}
+
+	paramList := "void"
+	if len(params) > 0 {
+		paramList = strings.Join(params, ", ")
+	}
+	header := cDeclaration(result, cName) + "(" + paramList + ")"
+	fmt.Fprintf(&self.Prototypes, "%s;\n", header)
+
+	W := &self.Functions
+	fmt.Fprintf(W, "\n%s\n{\n", header)
+	if F.Vars != nil {
+		self.generateVarDecl(W, F.Vars, "\t")
+	}
+
+	self.result = ""
+	defer func() { self.result = "" }()
+	if F.Result != nil {
+		if usesResult(F.Body) {
+			declared := declaredResult(F)
+			if declared != "" {
+				self.result = self.cName(declared)
+			} else {
+				self.result = self.cName(resultNames[0])
+				fmt.Fprintf(W, "\t%s;\n", cDeclaration(result, self.result))
+			}
+		}
+	}
+
+	if B, ok := F.Body.(*TBlockStmt); ok {
+		// тело функции уже в фигурных скобках, поэтому скобки от
+		// 'начало' и 'конец' не выводятся
+		if E := self.generateStatements(W, B.List, "\t"); E != nil {
+			return E
+		}
+	} else if E := self.generateStatement(W, F.Body, "\t"); E != nil {
+		return E
+	}
+	if self.result != "" && !endsWithReturn(F.Body) {
+		fmt.Fprintf(W, "\treturn %s;\n", self.result)
+	}
+	W.WriteString("}\n")
+
+	return nil
+}
+
+func (self *TCGenerator) generateStatements(W *bytes.Buffer, AList []TStmt,
+	AIndent string) error {
+	for _, S := range AList {
+		if E := self.generateStatement(W, S, AIndent); E != nil {
+			return E
+		}
+	}
+	return nil
+}
+
+func (self *TCGenerator) generateStatement(W *bytes.Buffer, S TStmt,
+	AIndent string) error {
+	switch N := S.(type) {
+	case *TAssignStmt:
+		X, E := self.generateExpression(N.Value)
+		if E != nil {
+			return E
+		}
+		fmt.Fprintf(W, "%s%s = %s;\n", AIndent, self.identName(N.Target.Name), X)
+
+	case *TCallStmt:
+		X, E := self.generateCall(N.Call)
+		if E != nil {
+			return E
+		}
+		fmt.Fprintf(W, "%s%s;\n", AIndent, X)
+
+	case *TVarDecl:
+		self.generateVarDecl(W, N, AIndent)
+
+	case *TBlockStmt:
+		fmt.Fprintf(W, "%s{\n", AIndent)
+		if E := self.generateStatements(W, N.List, AIndent+"\t"); E != nil {
+			return E
+		}
+		fmt.Fprintf(W, "%s}\n", AIndent)
+
+	case *TIfStmt:
+		X, E := self.generateExpression(N.Cond)
+		if E != nil {
+			return E
+		}
+		fmt.Fprintf(W, "%sif (%s)\n", AIndent, X)
+		if E = self.generateBranch(W, N.Then, AIndent); E != nil {
+			return E
+		}
+		if N.Else != nil {
+			fmt.Fprintf(W, "%selse\n", AIndent)
+			return self.generateBranch(W, N.Else, AIndent)
+		}
+
+	case *TWhileStmt:
+		X, E := self.generateExpression(N.Cond)
+		if E != nil {
+			return E
+		}
+		fmt.Fprintf(W, "%swhile (%s)\n", AIndent, X)
+		return self.generateBranch(W, N.Body, AIndent)
+
+	case *TForStmt:
+		return self.generateFor(W, N, AIndent)
+
+	case *TRepeatStmt:
+		// повторять ... до А -> do { ... } while (!А);
+		cond := N.Cond
+		if N.Until {
+			cond = &TUnaryExpr{TNodeBase: N.TNodeBase, Op: ltitNOT, X: cond}
+		}
+		X, E := self.generateExpression(cond)
+		if E != nil {
+			return E
+		}
+		fmt.Fprintf(W, "%sdo\n", AIndent)
+		if E = self.generateBranch(W, N.Body, AIndent); E != nil {
+			return E
+		}
+		fmt.Fprintf(W, "%swhile (%s);\n", AIndent, X)
+
+	case *TReturnStmt:
+		switch {
+		case N.Result != nil:
+			X, E := self.generateExpression(N.Result)
+			if E != nil {
+				return E
+			}
+			fmt.Fprintf(W, "%sreturn %s;\n", AIndent, X)
+		case self.result != "":
+			fmt.Fprintf(W, "%sreturn %s;\n", AIndent, self.result)
+		default:
+			fmt.Fprintf(W, "%sreturn;\n", AIndent)
+		}
+
+	case *TFuncDecl:
+		return N.Pos.errorAt(EGenNestedFunction)
+
+	default:
+		return S.Position().errorAt(EGenUnknownNode)
+	}
+
+	return nil
+}
+
+// Имя на СИ для переменной; переменная результата функции в любом
+// написании получает одно имя
+func (self *TCGenerator) identName(AName string) string {
+	if self.result != "" && isResultName(AName) {
+		return self.result
+	}
+	return self.cName(AName)
+}
+
+// Возвращает имя параметра или локальной переменной, объявленной как
+// переменная результата, или пустую строку
+func declaredResult(F *TFuncDecl) string {
+	specs := F.Params
+	if F.Vars != nil {
+		specs = append(specs[:len(specs):len(specs)], F.Vars.Specs...)
+	}
+	for _, spec := range specs {
+		for _, name := range spec.Names {
+			if isResultName(name.Name) {
+				return name.Name
+			}
+		}
+	}
+	return ""
+}
+
+// Возвращает истину, если в операторах используется переменная результата
+// или 'вернуть' без значения, которое возвращает эту переменную
+func usesResult(S TStmt) bool {
+	used := false
+	walkNode(S, func(N TNode) bool {
+		switch X := N.(type) {
+		case *TIdent:
+			used = used || isResultName(X.Name)
+		case *TReturnStmt:
+			used = used || X.Result == nil
+		}
+		return !used
+	})
+	return used
+}
+
+func endsWithReturn(S TStmt) bool {
+	if B, ok := S.(*TBlockStmt); ok {
+		if len(B.List) == 0 {
+			return false
+		}
+		S = B.List[len(B.List)-1]
+	}
+	_, ok := S.(*TReturnStmt)
+	return ok
+}
+
+/*
+ Переводит цикл 'для' в цикл for языка СИ:
+ для И от 1 до Н шаг 2 -> for (I = 1; I <= N; I += 2)
+ Граница и шаг вычисляются перед каждым повтором, как в СИ.
+*/
+func (self *TCGenerator) generateFor(W *bytes.Buffer, N *TForStmt,
+	AIndent string) error {
+	V := self.identName(N.Var.Name)
+	from, E := self.generateExpression(N.From)
+	if E != nil {
+		return E
+	}
+	to, E := self.generateExpression(N.To)
+	if E != nil {
+		return E
+	}
+
+	compare, next, assign := "<=", V+"++", " += "
+	if N.Down {
+		compare, next, assign = ">=", V+"--", " -= "
+	}
+	if N.Step != nil {
+		step, E := self.generateExpression(N.Step)
+		if E != nil {
+			return E
+		}
+		next = V + assign + step
+	}
+
+	fmt.Fprintf(W, "%sfor (%s = %s; %s %s %s; %s)\n", AIndent, V, from, V,
+		compare, to, next)
+	return self.generateBranch(W, N.Body, AIndent)
+}
+
+// Ветка оператора всегда выводится в фигурных скобках
+func (self *TCGenerator) generateBranch(W *bytes.Buffer, S TStmt,
+	AIndent string) error {
+	if _, ok := S.(*TBlockStmt); ok {
+		return self.generateStatement(W, S, AIndent)
+	}
+
+	fmt.Fprintf(W, "%s{\n", AIndent)
+	if E := self.generateStatement(W, S, AIndent+"\t"); E != nil {
+		return E
+	}
+	fmt.Fprintf(W, "%s}\n", AIndent)
+	return nil
+}
+
+func cOperation(AType TLanguageItemType) (string, bool) {
+	switch AType {
+	case ltitMathAdd:
+		return "+", true
+	case ltitMathSub:
+		return "-", true
+	case ltitMathMul:
+		return "*", true
+	case ltitMathDiv:
+		return "/", true
+	case ltitModulo:
+		return "%", true
+	case ltitEqual:
+		return "==", true
+	case ltitAbove:
+		return ">", true
+	case ltitBelow:
+		return "<", true
+	case ltitAboveEqual:
+		return ">=", true
+	case ltitBelowEqual:
+		return "<=", true
+	case ltitNotEqual:
+		return "!=", true
+	case ltitLeftShift:
+		return "<<", true
+	case ltitRightShift:
+		return ">>", true
+	case ltitBitAND:
+		return "&", true
+	case ltitBitOR:
+		return "|", true
+	case ltitBitXOR:
+		return "^", true
+	case ltitAND:
+		return "&&", true
+	case ltitOR:
+		return "||", true
+	case ltitXOR:
+		return "!=", true
+	case ltitNOT:
+		return "!", true
+	case ltitNegate:
+		return "-", true
+	case ltitUnaryPlus:
+		return "+", true
+	case ltitBitNOT:
+		return "~", true
+	case ltitAddressOf:
+		return "&", true
+	}
+	return "", false
+}
+
+// Приоритет выражения в языке СИ, чем больше число, тем раньше
+// выполняется операция
+func cPriority(X TExpr) int {
+	switch N := X.(type) {
+	case *TUnaryExpr:
+		return 14
+	case *TBinaryExpr:
+		switch N.Op {
+		case ltitMathMul, ltitMathDiv, ltitModulo:
+			return 13
+		case ltitMathAdd, ltitMathSub:
+			return 12
+		case ltitLeftShift, ltitRightShift:
+			return 11
+		case ltitAbove, ltitBelow, ltitAboveEqual, ltitBelowEqual:
+			return 10
+		case ltitEqual, ltitNotEqual, ltitXOR:
+			return 9
+		case ltitBitAND:
+			return 8
+		case ltitBitXOR:
+			return 7
+		case ltitBitOR:
+			return 6
+		case ltitAND:
+			return 5
+		case ltitOR:
+			return 4
+		case ltitInvolution:
+			// вызов функции pow
+			return 15
+		}
+		return 0
+	}
+	// идентификаторы, константы и вызовы функций
+	return 15
+}
+
+/*
+ Возвращает истину, если операнд X операции AOperation надо заключить в
+ скобки для ясности, хотя по приоритетам СИ они не нужны: "(А + Б) & В",
+ "А || (Б && В)". Без них компилятор СИ выдаёт предупреждения.
+*/
+func cClarify(AOperation TLanguageItemType, X TExpr) bool {
+	N, ok := X.(*TBinaryExpr)
+	if !ok || N.Op == AOperation || N.Op == ltitInvolution {
+		return false
+	}
+	switch AOperation {
+	case ltitOR:
+		return N.Op == ltitAND
+	case ltitBitAND, ltitBitOR, ltitBitXOR, ltitLeftShift, ltitRightShift:
+		return true
+	}
+	return false
+}
+
+// Записывает строку S как строковую константу языка СИ
+func cString(S string) string {
+	var B strings.Builder
+	B.WriteByte('"')
+	for i := 0; i < len(S); i++ {
+		C := S[i]
+		switch {
+		case C == '"' || C == '\\':
+			B.WriteByte('\\')
+			B.WriteByte(C)
+		case C == '\n':
+			B.WriteString("\\n")
+		case C == '\t':
+			B.WriteString("\\t")
+		case C == '\r':
+			B.WriteString("\\r")
+		case C < ' ' || C == 0x7F:
+			fmt.Fprintf(&B, "\\%03o", C)
+		case C >= 0x80:
+			// байт \xHH, не входящий в символ UTF-8, записывается числом
+			R, size := utf8.DecodeRuneInString(S[i:])
+			if R == utf8.RuneError && size == 1 {
+				fmt.Fprintf(&B, "\\%03o", C)
+			} else {
+				B.WriteString(S[i : i+size])
+				i += size - 1
+			}
+		default:
+			B.WriteByte(C)
+		}
+	}
+	B.WriteByte('"')
+	return B.String()
+}
+
+// Записывает символ как символьную константу СИ, символы вне ASCII
+// записываются номером символа, а байт \xHH — своим значением
+func cChar(S string) string {
+	C, _ := utf8.DecodeRuneInString(S)
+	switch {
+	case len(S) == 1 && S[0] >= 0x80:
+		return strconv.Itoa(int(S[0]))
+	case C == 0x27 || C == 0x5C:
+		return "'\\" + string(C) + "'"
+	case C == '\n':
+		return "'\\n'"
+	case C == '\t':
+		return "'\\t'"
+	case C == '\r':
+		return "'\\r'"
+	case C < ' ' || C == 0x7F:
+		return fmt.Sprintf("'\\%03o'", C)
+	case C > 0x7F:
+		return strconv.Itoa(int(C))
+	}
+	return "'" + string(C) + "'"
+}
+
+// Переводит операнд, заключая его в скобки, если его приоритет меньше
+// APriority
+func (self *TCGenerator) generateOperand(X TExpr, APriority int) (string,
+	error) {
+	S, E := self.generateExpression(X)
+	if E != nil {
+		return "", E
+	}
+	if cPriority(X) < APriority {
+		S = "(" + S + ")"
+	}
+	return S, nil
+}
+
+// Переводит вызов функции. Метод объекта вызывается как функция, объявленная
+// для класса: Объект.Метод(А) -> Obekt_Metod(A)
+func (self *TCGenerator) generateCall(C *TCallExpr) (string, error) {
+	name := C.Func.Name
+	if C.Object != nil {
+		name = C.Object.Name + " " + name
+	}
+
+	args := make([]string, 0, len(C.Args))
+	for _, X := range C.Args {
+		S, E := self.generateExpression(X)
+		if E != nil {
+			return "", E
+		}
+		args = append(args, S)
+	}
+
+	return self.cName(name) + "(" + strings.Join(args, ", ") + ")", nil
+}
+
+// Переводит выражение, скобки расставляются по приоритетам операций
+// языка СИ
+func (self *TCGenerator) generateExpression(X TExpr) (string, error) {
+	switch N := X.(type) {
+	case *TIdent:
+		return self.identName(N.Name), nil
+
+	case *TCallExpr:
+		return self.generateCall(N)
+
+	case *TLiteral:
+		if N.Kind == ltitString {
+			return cString(N.Value), nil
+		}
+		if N.Kind == ltitChar {
+			return cChar(N.Value), nil
+		}
+		if N.Number.Big != nil {
+			// целое больше int64 допустимо только как беззнаковое
+			if !N.Number.Big.IsUint64() {
+				return "", N.Pos.errorAt(EGenNumberTooBig)
+			}
+			return N.Value + "ULL", nil
+		}
+		// 9223372036854775808 в СИ не помещается в int64_t
+		if !N.Number.IsFloat && N.Number.Int == math.MinInt64 {
+			return "INT64_MIN", nil
+		}
+		return N.Value, nil
+
+	case *TUnaryExpr:
+		op, ok := cOperation(N.Op)
+		if !ok {
+			return "", N.Pos.errorAt(EGenUnknownOperation)
+		}
+		S, E := self.generateOperand(N.X, cPriority(N))
+		if E != nil {
+			return "", E
+		}
+		// - -А и + +А в СИ читаются как -- и ++
+		if (op == "-" || op == "+") && strings.HasPrefix(S, op) {
+			S = "(" + S + ")"
+		}
+		return op + S, nil
+
+	case *TBinaryExpr:
+		if N.Op == ltitInvolution {
+			return self.generatePower(N)
+		}
+		op, ok := cOperation(N.Op)
+		if !ok {
+			return "", N.Pos.errorAt(EGenUnknownOperation)
+		}
+		// операции левоассоциативны, поэтому правый операнд с таким же
+		// приоритетом заключается в скобки
+		left := cPriority(N)
+		right, prefix := left+1, ""
+		// логическое исключающее ИЛИ: !А != !Б
+		if N.Op == ltitXOR {
+			left = cPriority(&TUnaryExpr{})
+			right, prefix = left, "!"
+		}
+		if cClarify(N.Op, N.X) {
+			left = cPriority(N.X) + 1
+		}
+		if cClarify(N.Op, N.Y) {
+			right = cPriority(N.Y) + 1
+		}
+		SX, E := self.generateOperand(N.X, left)
+		if E != nil {
+			return "", E
+		}
+		SY, E := self.generateOperand(N.Y, right)
+		if E != nil {
+			return "", E
+		}
+		return prefix + SX + " " + op + " " + prefix + SY, nil
+	}
+
+	return "", X.Position().errorAt(EGenUnknownNode)
+}
+
+// Переводит возведение в степень в вызов pow из math.h
+func (self *TCGenerator) generatePower(N *TBinaryExpr) (string, error) {
+	SX, E := self.generateExpression(N.X)
+	if E != nil {
+		return "", E
+	}
+	SY, E := self.generateExpression(N.Y)
+	if E != nil {
+		return "", E
+	}
+	self.UsesMath = true
+	return "pow(" + SX + ", " + SY + ")", nil
+}
+
+func (self *TCGenerator) generateProgram(P *TProgram) error {
+	for _, S := range P.List {
+		var E error
+		switch N := S.(type) {
+		case *TFuncDecl:
+			E = self.generateFunction(N)
+		case *TVarDecl:
+			self.generateVarDecl(&self.Globals, N, "")
+		default:
+			E = self.generateStatement(&self.MainBody, S, "\t")
+		}
+		if E != nil {
+			return E
+		}
+	}
+
+	return nil
+}
+
+func (self *TCGenerator) writeTo(W io.Writer) error {
+	var B bytes.Buffer
+
+	B.WriteString("/* Сгенерировано lsa */\n")
+	B.WriteString("#include <stdbool.h>\n#include <stdint.h>\n")
+	if self.UsesMath {
+		B.WriteString("#include <math.h>\n")
+	}
+
+	if self.Globals.Len() > 0 {
+		B.WriteString("\n")
+		B.Write(self.Globals.Bytes())
+	}
+	if self.Prototypes.Len() > 0 {
+		B.WriteString("\n")
+		B.Write(self.Prototypes.Bytes())
+	}
+	B.Write(self.Functions.Bytes())
+
+	B.WriteString("\nint main(void)\n{\n")
+	if self.MainBody.Len() == 0 && self.MainFunction != "" {
+		fmt.Fprintf(&self.MainBody, "\t%s();\n", self.MainFunction)
+	}
+	B.Write(self.MainBody.Bytes())
+	B.WriteString("\treturn 0;\n}\n")
+
+	_, E := W.Write(B.Bytes())
+	return E
+}
@@ -0,0 +1,155 @@
+package lsa
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Сообщения о найденных в программе ошибках. Переводчик не прекращает
+// работу на первой ошибке, а записывает её в список и продолжает перевод
+// со следующей точки синхронизации.
+
+type TSeverity uint
+
+const (
+	SeverityError TSeverity = iota
+	SeverityWarning
+	SeverityNote
+)
+
+// названия для JSON, не зависят от языка сообщений
+var severityKeys = [...]string{"error", "warning", "note"}
+
+func (self TSeverity) String() string {
+	return self.Name(LanguageRussian)
+}
+
+// Название важности сообщения на языке ALanguage
+func (self TSeverity) Name(ALanguage TLanguage) string {
+	if int(ALanguage) >= len(severityLanguageNames) {
+		ALanguage = LanguageRussian
+	}
+	if names := severityLanguageNames[ALanguage]; int(self) < len(names) {
+		return names[self]
+	}
+	return fmt.Sprintf("TSeverity(%d)", uint(self))
+}
+
+func (self TSeverity) MarshalText() ([]byte, error) {
+	if int(self) < len(severityKeys) {
+		return []byte(severityKeys[self]), nil
+	}
+	return nil, fmt.Errorf("неизвестная важность сообщения %d", uint(self))
+}
+
+// Дополнительная пометка участка текста, относящегося к сообщению
+type TLabel struct {
+	Span TSpan         `json:"span"`
+	Code string        `json:"code,omitempty"`
+	Args []interface{} `json:"args,omitempty"`
+	Msg  string        `json:"message"`
+}
+
+// Пояснение к сообщению
+type TNote struct {
+	Code string        `json:"code,omitempty"`
+	Args []interface{} `json:"args,omitempty"`
+	Msg  string        `json:"message"`
+}
+
+type TDiagnostic struct {
+	Severity TSeverity `json:"severity"`
+	// постоянный код сообщения, например E202, по нему текст сообщения
+	// выбирается из каталога
+	Code string        `json:"code"`
+	Args []interface{} `json:"args,omitempty"`
+	Span TSpan         `json:"span"`
+	Msg  string        `json:"message"`
+	// дополнительные пояснения, например где начинается незакрытый блок
+	Notes  []TNote  `json:"notes,omitempty"`
+	Labels []TLabel `json:"labels,omitempty"`
+}
+
+func (self TDiagnostic) String() string {
+	return fmt.Sprintf("[%v:%v] %v %v: %v", self.Span.Start.LineNo,
+		self.Span.Start.ColumnNo, self.Severity, self.Code, self.Msg)
+}
+
+/*
+ Возвращает копию сообщения с текстами на языке ALanguage. Тексты, коды
+ которых нет в каталоге, не изменяются.
+*/
+func (self TDiagnostic) Localize(ALanguage TLanguage) TDiagnostic {
+	D := self
+	D.Msg = localize(D.Code, D.Msg, ALanguage, D.Args)
+	D.Notes = make([]TNote, len(self.Notes))
+	for i, N := range self.Notes {
+		N.Msg = localize(N.Code, N.Msg, ALanguage, N.Args)
+		D.Notes[i] = N
+	}
+	D.Labels = make([]TLabel, len(self.Labels))
+	for i, L := range self.Labels {
+		L.Msg = localize(L.Code, L.Msg, ALanguage, L.Args)
+		D.Labels[i] = L
+	}
+	return D
+}
+
+func localize(ACode, AMsg string, ALanguage TLanguage,
+	AArgs []interface{}) string {
+	if _, ok := messageCatalogue[ACode]; !ok {
+		return AMsg
+	}
+	return Message(ACode, ALanguage, AArgs...)
+}
+
+type TDiagnostics []TDiagnostic
+
+// Возвращает копию списка с текстами на языке ALanguage
+func (self TDiagnostics) Localize(ALanguage TLanguage) TDiagnostics {
+	list := make(TDiagnostics, len(self))
+	for i, D := range self {
+		list[i] = D.Localize(ALanguage)
+	}
+	return list
+}
+
+// Возвращает количество сообщений об ошибках
+func (self TDiagnostics) ErrorCount() int {
+	count := 0
+	for _, D := range self {
+		if D.Severity == SeverityError {
+			count++
+		}
+	}
+	return count
+}
+
+// Создаёт сообщение об ошибке E, например об ошибке лексического анализа
+func DiagnosticOf(E error) TDiagnostic {
+	D := TDiagnostic{Severity: SeverityError, Msg: E.Error()}
+	var lsaE *lsaError
+	if errors.As(E, &lsaE) {
+		D.Code = lsaE.Code
+		D.Msg = lsaE.Msg
+		D.Span = lsaE.Span
+	}
+	return D
+}
+
+// Создаёт сообщение с текстом из каталога
+func newDiagnostic(ASeverity TSeverity, ASpan TSpan, ACode string,
+	AArgs ...interface{}) TDiagnostic {
+	return TDiagnostic{Severity: ASeverity, Code: ACode, Args: AArgs,
+		Span: ASpan, Msg: Message(ACode, LanguageRussian, AArgs...)}
+}
+
+func newNote(ACode string, AArgs ...interface{}) TNote {
+	return TNote{Code: ACode, Args: AArgs,
+		Msg: Message(ACode, LanguageRussian, AArgs...)}
+}
+
+func newLabel(ASpan TSpan, ACode string, AArgs ...interface{}) TLabel {
+	return TLabel{Span: ASpan, Code: ACode, Args: AArgs,
+		Msg: Message(ACode, LanguageRussian, AArgs...)}
+}
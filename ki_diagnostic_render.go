@@ -0,0 +1,213 @@
+package lsa
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Вывод сообщений об ошибках для человека, с фрагментом текста программы,
+// и в формате JSON для других программ
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[1;31m"
+	ansiYellow = "\x1b[1;33m"
+	ansiCyan   = "\x1b[1;36m"
+	ansiBlue   = "\x1b[1;34m"
+)
+
+var severityColors = [...]string{ansiRed, ansiYellow, ansiCyan}
+
+type TRenderer struct {
+	// имя файла в строке с положением ошибки
+	FileName string
+	// текст программы, например TReader.SourceText()
+	Source string
+	// ширина табуляции, должна совпадать с TReader.TabWidth
+	TabWidth uint
+	// выделять части сообщения цветом для терминала
+	Colors bool
+	// язык сообщений
+	Language TLanguage
+	lines    []string
+}
+
+// Пометка участка строки: основная ^^^ или дополнительная ---
+type tMarker struct {
+	Span    TSpan
+	Msg     string
+	Primary bool
+}
+
+func (self *TRenderer) paint(AColor, S string) string {
+	if !self.Colors || AColor == "" {
+		return S
+	}
+	return AColor + S + ansiReset
+}
+
+// Строки текста программы, концы строк CR LF, CR и LF
+func (self *TRenderer) sourceLines() []string {
+	if self.lines == nil {
+		text := strings.TrimPrefix(self.Source, "\uFEFF")
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		text = strings.ReplaceAll(text, "\r", "\n")
+		self.lines = strings.Split(text, "\n")
+	}
+	return self.lines
+}
+
+// Заменяет табуляции пробелами так же, как их считает TReader
+func (self *TRenderer) expandTabs(S string) string {
+	if !strings.ContainsRune(S, '\t') {
+		return S
+	}
+	var B strings.Builder
+	column := uint(0)
+	for _, C := range S {
+		if C != '\t' {
+			B.WriteRune(C)
+			column++
+			continue
+		}
+		next := column + 1
+		if self.TabWidth > 0 {
+			next = (column/self.TabWidth + 1) * self.TabWidth
+		}
+		B.WriteString(strings.Repeat(" ", int(next-column)))
+		column = next
+	}
+	return B.String()
+}
+
+/*
+ Выводит сообщение в виде:
+ ошибка[E205]: Слишком много (
+   --> файл.l:3:7
+    |
+  3 |   Б = (1
+    |       ^
+    = примечание: ...
+ Номера строк и колонок выводятся, начиная с 1, как в редакторах текста.
+*/
+func (self *TRenderer) Render(W io.Writer, D TDiagnostic) error {
+	var B strings.Builder
+	D = D.Localize(self.Language)
+	color := ""
+	if int(D.Severity) < len(severityColors) {
+		color = severityColors[D.Severity]
+	}
+
+	head := D.Severity.Name(self.Language)
+	if D.Code != "" {
+		head += "[" + D.Code + "]"
+	}
+	B.WriteString(self.paint(color, head) + self.paint(ansiBold, ": "+D.Msg) + "\n")
+
+	markers := []tMarker{{Span: D.Span, Primary: true}}
+	for _, L := range D.Labels {
+		markers = append(markers, tMarker{Span: L.Span, Msg: L.Msg})
+	}
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].Span.Start.LineNo < markers[j].Span.Start.LineNo
+	})
+
+	lines := self.sourceLines()
+	last := markers[len(markers)-1].Span.Start.LineNo
+	width := len(fmt.Sprint(last + 1))
+	gutter := strings.Repeat(" ", width)
+	bar := self.paint(ansiBlue, "|")
+
+	start := D.Span.Start
+	location := fmt.Sprintf("%d:%d", start.LineNo+1, start.ColumnNo+1)
+	if self.FileName != "" {
+		location = self.FileName + ":" + location
+	}
+	B.WriteString(gutter + self.paint(ansiBlue, "--> ") + location + "\n")
+	B.WriteString(gutter + " " + bar + "\n")
+
+	for i, M := range markers {
+		lineNo := M.Span.Start.LineNo
+		if int(lineNo) >= len(lines) {
+			continue
+		}
+		text := self.expandTabs(lines[lineNo])
+		if i == 0 || markers[i-1].Span.Start.LineNo != lineNo {
+			number := fmt.Sprintf("%*d", width, lineNo+1)
+			B.WriteString(self.paint(ansiBlue, number) + " " + bar + " " +
+				text + "\n")
+		}
+
+		// участок до конца строки, если он занимает несколько строк,
+		// и хотя бы один знак, если участок пустой
+		from := M.Span.Start.ColumnNo
+		to := M.Span.End.ColumnNo
+		if M.Span.End.LineNo != lineNo {
+			to = uint(len([]rune(text)))
+		}
+		if to <= from {
+			to = from + 1
+		}
+
+		mark, markColor := "-", ansiBlue
+		if M.Primary {
+			mark, markColor = "^", color
+		}
+		underline := strings.Repeat(mark, int(to-from))
+		if M.Msg != "" {
+			underline += " " + M.Msg
+		}
+		B.WriteString(gutter + " " + bar + " " + strings.Repeat(" ", int(from)) +
+			self.paint(markColor, underline) + "\n")
+	}
+
+	for _, N := range D.Notes {
+		B.WriteString(gutter + " " + self.paint(ansiBlue, "=") + " " +
+			self.paint(ansiBold, SeverityNote.Name(self.Language)) + ": " +
+			N.Msg + "\n")
+	}
+
+	_, E := io.WriteString(W, B.String())
+	return E
+}
+
+// Выводит все сообщения, разделяя их пустой строкой
+func (self *TRenderer) RenderAll(W io.Writer, AList TDiagnostics) error {
+	for i, D := range AList {
+		if i > 0 {
+			if _, E := io.WriteString(W, "\n"); E != nil {
+				return E
+			}
+		}
+		if E := self.Render(W, D); E != nil {
+			return E
+		}
+	}
+	return nil
+}
+
+/*
+ Выводит сообщения в формате JSON для программ проверки, язык текстов
+ выбирается заранее с помощью AList.Localize:
+ {"file": "...", "diagnostics": [{"severity": "error", "code": "E205",
+ "span": {...}, "message": "..."}]}
+ Номера строк и колонок в JSON начинаются с 0, как в TPosition.
+*/
+func RenderJSON(W io.Writer, AFileName string, AList TDiagnostics) error {
+	if AList == nil {
+		AList = TDiagnostics{}
+	}
+	report := struct {
+		File        string       `json:"file,omitempty"`
+		Diagnostics TDiagnostics `json:"diagnostics"`
+	}{AFileName, AList}
+
+	encoder := json.NewEncoder(W)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,230 @@
+package lsa
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Перекодирование текстов в однобайтовых кириллических кодировках в UTF-8.
+// Кодировку можно указать в TReader.Encoding или прагмой в первой строке
+// текста:
+//   //# кодировка = windows-1251
+// Каждый символ однобайтовой кодировки становится одним символом UTF-8,
+// поэтому номера колонок не меняются, а смещения в байтах относятся к
+// перекодированному тексту.
+
+type TEncoding uint
+
+const (
+	EncodingUTF8 TEncoding = iota
+	EncodingWindows1251
+	EncodingKOI8R
+	EncodingCP866
+	// кодировка определяется по тексту функцией DetectEncoding
+	EncodingAuto
+)
+
+type TEncodingName struct {
+	Name     string
+	Encoding TEncoding
+}
+
+var (
+	encodingNames = []TEncodingName{
+		{"utf-8", EncodingUTF8},
+		{"utf8", EncodingUTF8},
+		{"windows-1251", EncodingWindows1251},
+		{"cp1251", EncodingWindows1251},
+		{"1251", EncodingWindows1251},
+		{"koi8-r", EncodingKOI8R},
+		{"koi8r", EncodingKOI8R},
+		{"cp866", EncodingCP866},
+		{"ibm866", EncodingCP866},
+		{"866", EncodingCP866},
+		{"dos", EncodingCP866},
+	}
+
+	// ключевые слова прагмы кодировки
+	encodingPragmaKeys = []string{"кодировка", "encoding"}
+
+	// символы 0x80...0xFF
+	windows1251Table = [128]rune{
+		0x0402, 0x0403, 0x201A, 0x0453, 0x201E, 0x2026, 0x2020, 0x2021,
+		0x20AC, 0x2030, 0x0409, 0x2039, 0x040A, 0x040C, 0x040B, 0x040F,
+		0x0452, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+		0xFFFD, 0x2122, 0x0459, 0x203A, 0x045A, 0x045C, 0x045B, 0x045F,
+		0x00A0, 0x040E, 0x045E, 0x0408, 0x00A4, 0x0490, 0x00A6, 0x00A7,
+		0x0401, 0x00A9, 0x0404, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x0407,
+		0x00B0, 0x00B1, 0x0406, 0x0456, 0x0491, 0x00B5, 0x00B6, 0x00B7,
+		0x0451, 0x2116, 0x0454, 0x00BB, 0x0458, 0x0405, 0x0455, 0x0457,
+		0x0410, 0x0411, 0x0412, 0x0413, 0x0414, 0x0415, 0x0416, 0x0417,
+		0x0418, 0x0419, 0x041A, 0x041B, 0x041C, 0x041D, 0x041E, 0x041F,
+		0x0420, 0x0421, 0x0422, 0x0423, 0x0424, 0x0425, 0x0426, 0x0427,
+		0x0428, 0x0429, 0x042A, 0x042B, 0x042C, 0x042D, 0x042E, 0x042F,
+		0x0430, 0x0431, 0x0432, 0x0433, 0x0434, 0x0435, 0x0436, 0x0437,
+		0x0438, 0x0439, 0x043A, 0x043B, 0x043C, 0x043D, 0x043E, 0x043F,
+		0x0440, 0x0441, 0x0442, 0x0443, 0x0444, 0x0445, 0x0446, 0x0447,
+		0x0448, 0x0449, 0x044A, 0x044B, 0x044C, 0x044D, 0x044E, 0x044F,
+	}
+
+	koi8rTable = [128]rune{
+		0x2500, 0x2502, 0x250C, 0x2510, 0x2514, 0x2518, 0x251C, 0x2524,
+		0x252C, 0x2534, 0x253C, 0x2580, 0x2584, 0x2588, 0x258C, 0x2590,
+		0x2591, 0x2592, 0x2593, 0x2320, 0x25A0, 0x2219, 0x221A, 0x2248,
+		0x2264, 0x2265, 0x00A0, 0x2321, 0x00B0, 0x00B2, 0x00B7, 0x00F7,
+		0x2550, 0x2551, 0x2552, 0x0451, 0x2553, 0x2554, 0x2555, 0x2556,
+		0x2557, 0x2558, 0x2559, 0x255A, 0x255B, 0x255C, 0x255D, 0x255E,
+		0x255F, 0x2560, 0x2561, 0x0401, 0x2562, 0x2563, 0x2564, 0x2565,
+		0x2566, 0x2567, 0x2568, 0x2569, 0x256A, 0x256B, 0x256C, 0x00A9,
+		0x044E, 0x0430, 0x0431, 0x0446, 0x0434, 0x0435, 0x0444, 0x0433,
+		0x0445, 0x0438, 0x0439, 0x043A, 0x043B, 0x043C, 0x043D, 0x043E,
+		0x043F, 0x044F, 0x0440, 0x0441, 0x0442, 0x0443, 0x0436, 0x0432,
+		0x044C, 0x044B, 0x0437, 0x0448, 0x044D, 0x0449, 0x0447, 0x044A,
+		0x042E, 0x0410, 0x0411, 0x0426, 0x0414, 0x0415, 0x0424, 0x0413,
+		0x0425, 0x0418, 0x0419, 0x041A, 0x041B, 0x041C, 0x041D, 0x041E,
+		0x041F, 0x042F, 0x0420, 0x0421, 0x0422, 0x0423, 0x0416, 0x0412,
+		0x042C, 0x042B, 0x0417, 0x0428, 0x042D, 0x0429, 0x0427, 0x042A,
+	}
+
+	cp866Table = [128]rune{
+		0x0410, 0x0411, 0x0412, 0x0413, 0x0414, 0x0415, 0x0416, 0x0417,
+		0x0418, 0x0419, 0x041A, 0x041B, 0x041C, 0x041D, 0x041E, 0x041F,
+		0x0420, 0x0421, 0x0422, 0x0423, 0x0424, 0x0425, 0x0426, 0x0427,
+		0x0428, 0x0429, 0x042A, 0x042B, 0x042C, 0x042D, 0x042E, 0x042F,
+		0x0430, 0x0431, 0x0432, 0x0433, 0x0434, 0x0435, 0x0436, 0x0437,
+		0x0438, 0x0439, 0x043A, 0x043B, 0x043C, 0x043D, 0x043E, 0x043F,
+		0x2591, 0x2592, 0x2593, 0x2502, 0x2524, 0x2561, 0x2562, 0x2556,
+		0x2555, 0x2563, 0x2551, 0x2557, 0x255D, 0x255C, 0x255B, 0x2510,
+		0x2514, 0x2534, 0x252C, 0x251C, 0x2500, 0x253C, 0x255E, 0x255F,
+		0x255A, 0x2554, 0x2569, 0x2566, 0x2560, 0x2550, 0x256C, 0x2567,
+		0x2568, 0x2564, 0x2565, 0x2559, 0x2558, 0x2552, 0x2553, 0x256B,
+		0x256A, 0x2518, 0x250C, 0x2588, 0x2584, 0x258C, 0x2590, 0x2580,
+		0x0440, 0x0441, 0x0442, 0x0443, 0x0444, 0x0445, 0x0446, 0x0447,
+		0x0448, 0x0449, 0x044A, 0x044B, 0x044C, 0x044D, 0x044E, 0x044F,
+		0x0401, 0x0451, 0x0404, 0x0454, 0x0407, 0x0457, 0x040E, 0x045E,
+		0x00B0, 0x2219, 0x00B7, 0x221A, 0x2116, 0x00A4, 0x25A0, 0x00A0,
+	}
+
+	// самые частые буквы русских текстов, по ним определяется кодировка
+	frequentLetters = "оеаинтсрвл"
+)
+
+var EUnknownEncoding = newError("E109")
+
+// Возвращает кодировку по её названию, регистр букв не учитывается
+func EncodingByName(AName string) (TEncoding, bool) {
+	AName = strings.ToLower(strings.TrimSpace(AName))
+	for _, N := range encodingNames {
+		if N.Name == AName {
+			return N.Encoding, true
+		}
+	}
+	return EncodingUTF8, false
+}
+
+func encodingTable(AEncoding TEncoding) *[128]rune {
+	switch AEncoding {
+	case EncodingWindows1251:
+		return &windows1251Table
+	case EncodingKOI8R:
+		return &koi8rTable
+	case EncodingCP866:
+		return &cp866Table
+	}
+	return nil
+}
+
+// Перекодирует текст из однобайтовой кодировки AEncoding в UTF-8
+func DecodeText(AData []byte, AEncoding TEncoding) []byte {
+	table := encodingTable(AEncoding)
+	if table == nil {
+		return AData
+	}
+
+	result := make([]byte, 0, len(AData)*2)
+	for _, B := range AData {
+		if B < 0x80 {
+			result = append(result, B)
+		} else {
+			result = utf8.AppendRune(result, table[B-0x80])
+		}
+	}
+	return result
+}
+
+/*
+ Определяет кодировку текста: прагма в первой строке, затем правильный UTF-8,
+ иначе однобайтовая кодировка, в которой больше всего частых русских букв.
+*/
+func DetectEncoding(AData []byte) TEncoding {
+	if E, ok, _ := encodingPragma(firstLine(AData)); ok {
+		return E
+	}
+	if utf8.Valid(AData) {
+		return EncodingUTF8
+	}
+
+	best, bestCount := EncodingWindows1251, -1
+	for _, E := range []TEncoding{EncodingWindows1251, EncodingKOI8R,
+		EncodingCP866} {
+		table := encodingTable(E)
+		count := 0
+		for _, B := range AData {
+			if B >= 0x80 && strings.ContainsRune(frequentLetters, table[B-0x80]) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = E, count
+		}
+	}
+	return best
+}
+
+// Возвращает первую строку текста без знака порядка байтов
+func firstLine(AData []byte) string {
+	S := string(AData)
+	S = strings.TrimPrefix(S, string(utf8BOM))
+	if i := strings.IndexAny(S, "\r\n"); i >= 0 {
+		S = S[:i]
+	}
+	return S
+}
+
+/*
+ Разбирает прагму кодировки:
+ ПРАГМА = '//#' ('кодировка' | 'encoding') '=' <НАЗВАНИЕ КОДИРОВКИ>
+ Возвращает ok = ложь, если комментарий не является прагмой кодировки, и
+ known = ложь, если название кодировки неизвестно.
+*/
+func encodingPragma(AComment string) (E TEncoding, ok bool, known bool) {
+	name, ok := pragmaValue(AComment, encodingPragmaKeys)
+	if !ok {
+		return EncodingUTF8, false, false
+	}
+	E, known = EncodingByName(name)
+	return E, true, known
+}
+
+/*
+ Возвращает значение прагмы '//#' <КЛЮЧ> '=' <ЗНАЧЕНИЕ>, если ключ
+ комментария AComment — один из AKeys
+*/
+func pragmaValue(AComment string, AKeys []string) (string, bool) {
+	S := strings.TrimSpace(AComment)
+	if !strings.HasPrefix(S, "//#") {
+		return "", false
+	}
+	S = strings.TrimSpace(S[3:])
+
+	for _, key := range AKeys {
+		if len(S) >= len(key) && strings.EqualFold(S[:len(key)], key) {
+			S = strings.TrimSpace(S[len(key):])
+			if !strings.HasPrefix(S, "=") {
+				return "", false
+			}
+			return strings.TrimSpace(S[1:]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,176 @@
+package lsa
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+ Преобразование текста программы к одному набору зарезервированных слов.
+ Каждое слово заменяется основным словом понятия в новом наборе, например
+ function и func — словом функция. Идентификаторы, пробелы и комментарии
+ остаются без изменений.
+*/
+
+var EKeywordConflict = newError("E112")
+
+func isWordRune(C rune) bool {
+	return isIdentLetter(C) || isDigit(C)
+}
+
+/*
+ Переписывает текст ASource словами набора ATarget. Слова текста
+ распознаются так же, как при переводе: набором из TReader.Keywords или
+ прагмы '//# слова = ...', иначе стандартным набором. Скобки { и }
+ заменяются словами начала и конца блока, если их нет в наборе ATarget.
+ Прагма набора слов получает название нового набора, а если текста без
+ прагмы стандартный набор не поймёт, то прагма добавляется в начало текста.
+ Слова, зарезервированные только в части оператора, например 'до' в
+ заголовке цикла, заменяются там, где их распознал перевод текста, а в
+ идентификаторах остаются. Операции словами заменяются и в операторах с
+ ошибкой, если стоят после операнда. Если идентификатор текста —
+ зарезервированное слово ATarget, то возвращается ошибка EKeywordConflict
+ с положением идентификатора.
+ Результат всегда в кодировке UTF-8.
+*/
+func ConvertKeywords(ASource []byte, ATarget *TKeywordSet) ([]byte, error) {
+	R := NewBytesReader(ASource)
+	R.KeepComments = true
+	first, E := R.BuildLexems()
+	if E != nil {
+		return nil, E
+	}
+	from := R.Keywords
+	if from == nil {
+		from = standardKeywords
+	}
+	text := R.SourceText()
+
+	// слова, зарезервированные только в части оператора, распознаёт
+	// перевод; после ошибки перевод пропускает часть оператора, и такие
+	// слова в ней остаются как есть, кроме операций словами
+	sd := newSyntaxDescriptor(first)
+	sd.Keywords = R.Keywords
+	sd.contextUses = map[uint64]TKeywordId{}
+	sd.translateProgram()
+
+	var B strings.Builder
+	last := 0
+	hasPragma, needPragma := false, false
+
+	replace := func(ASpan TSpan, S string) {
+		start, end := int(ASpan.Start.Offset), int(ASpan.End.Offset)
+		B.WriteString(text[last:start])
+		// слово не должно слиться с соседними словами
+		isWord := S != "" && isWordRune([]rune(S)[0])
+		if C, _ := utf8.DecodeLastRuneInString(B.String()); isWord &&
+			isWordRune(C) {
+			B.WriteString(" ")
+		}
+		B.WriteString(S)
+		if C, _ := utf8.DecodeRuneInString(text[end:]); isWord && isWordRune(C) {
+			B.WriteString(" ")
+		}
+		last = end
+	}
+
+	convert := func(AId TKeywordId, ASpan TSpan) {
+		W := ATarget.Word(AId)
+		// в наборе может не быть слова, заменяющего два слова
+		if W == "" && AId == kwiDownTo {
+			down, to := ATarget.Word(kwiDown), ATarget.Word(kwiTo)
+			if down != "" && to != "" {
+				replace(ASpan, down+" "+to)
+				needPragma = needPragma || standardKeywords.Id(down) != kwiDown ||
+					standardKeywords.Id(to) != kwiTo
+			}
+			return
+		}
+		// 'until' в русском наборе записывается словом 'до'
+		if W == "" && AId == kwiUntil {
+			AId, W = kwiTo, ATarget.Word(kwiTo)
+		}
+		if W == "" {
+			return
+		}
+		replace(ASpan, W)
+		needPragma = needPragma || standardKeywords.Id(W) != AId
+	}
+
+	// предыдущая лексема заканчивает операнд
+	operand := false
+	for L := first; L != nil; L = L.Next {
+		afterOperand := operand
+		operand = false
+
+		for C := L.Comments; C != nil; C = C.Next {
+			S := (*C).LexemAsString()
+			if _, ok := pragmaValue(S, keywordPragmaKeys); ok &&
+				len(ATarget.Names) > 0 {
+				replace(C.Span, pragmaWithValue(S, ATarget.Names[0]))
+				hasPragma = true
+			} else if _, ok := pragmaValue(S, encodingPragmaKeys); ok &&
+				R.transcoded {
+				replace(C.Span, pragmaWithValue(S, "utf-8"))
+			}
+		}
+
+		switch L.Type {
+		case ltIdent:
+			S := (*L).LexemAsString()
+			id := from.Id(S)
+			if isContextKeyword(id) {
+				used, ok := sd.contextUses[L.Span.Start.Offset]
+				// перевод мог не дойти до операции из-за ошибки, тогда
+				// операцией её делает операнд перед ней
+				if !ok && afterOperand && isWordOperation(id) {
+					used = id
+				}
+				id = used
+			}
+			operand = id == kwiUnknown
+			// слово, которое в обоих наборах зарезервировано только в части
+			// оператора, остаётся словом идентификатора
+			if id != kwiUnknown {
+				convert(id, L.Span)
+			} else if T := ATarget.Id(S); T != kwiUnknown &&
+				!(isContextKeyword(T) && from.Id(S) == T) {
+				return nil, (*L).errorAt(EKeywordConflict)
+			}
+
+		case ltNumber, ltFloat, ltString, ltChar, ltCloseParenthesis,
+			ltCloseBracket:
+			operand = true
+
+		case ltLBrace:
+			if ATarget.Id("{") == kwiUnknown {
+				convert(kwiBegin, L.Span)
+			}
+
+		case ltRBrace:
+			if ATarget.Id("}") == kwiUnknown {
+				convert(kwiEnd, L.Span)
+			}
+		}
+	}
+	B.WriteString(text[last:])
+
+	result := B.String()
+	if needPragma && !hasPragma && len(ATarget.Names) > 0 {
+		bom := ""
+		if strings.HasPrefix(result, "\uFEFF") {
+			bom = "\uFEFF"
+			result = result[len(bom):]
+		}
+		result = bom + "//# " + keywordPragmaKeys[0] + " = " +
+			ATarget.Names[0] + "\n" + result
+	}
+	return []byte(result), nil
+}
+
+// Заменяет значение прагмы AComment на AValue, сохраняя её ключ
+func pragmaWithValue(AComment, AValue string) string {
+	S := strings.TrimRight(AComment, " \t\r")
+	i := strings.Index(S, "=")
+	return S[:i+1] + " " + AValue + AComment[len(S):]
+}
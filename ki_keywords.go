@@ -0,0 +1,277 @@
+package lsa
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/*
+ Наборы зарезервированных слов. Набор выбирается для каждого текста
+ параметром TReader.Keywords или прагмой перед первой лексемой текста:
+ //# слова = английский
+ Наборы загружаются из файла функцией LoadKeywordSet или создаются
+ функцией NewKeywordSet и регистрируются функцией RegisterKeywordSet.
+*/
+
+type TKeywordSet struct {
+	// названия набора, по ним набор выбирается в прагме
+	Names []string
+	words map[string]TKeywordId
+	// первое слово каждого понятия, им заменяются синонимы при
+	// преобразовании текста функцией ConvertKeywords
+	preferred map[TKeywordId]string
+}
+
+var (
+	// названия понятий в файле набора и в TKeywordSet.Add
+	keywordConcepts = map[string]TKeywordId{
+		"функция":    kwiFunction,
+		"function":   kwiFunction,
+		"переменные": kwiVariable,
+		"variable":   kwiVariable,
+		"начало":     kwiBegin,
+		"begin":      kwiBegin,
+		"конец":      kwiEnd,
+		"end":        kwiEnd,
+		"если":       kwiIf,
+		"if":         kwiIf,
+		"иначе":      kwiElse,
+		"else":       kwiElse,
+		"пока":       kwiWhile,
+		"while":      kwiWhile,
+		"не":         kwiNOT,
+		"not":        kwiNOT,
+		"и":          kwiAND,
+		"and":        kwiAND,
+		"или":        kwiOR,
+		"or":         kwiOR,
+		"искл":       kwiXOR,
+		"xor":        kwiXOR,
+		"сдвл":       kwiShl,
+		"shl":        kwiShl,
+		"сдвп":       kwiShr,
+		"shr":        kwiShr,
+		"процедура":  kwiProcedure,
+		"procedure":  kwiProcedure,
+		"вернуть":    kwiReturn,
+		"return":     kwiReturn,
+		"для":        kwiFor,
+		"for":        kwiFor,
+		"от":         kwiFrom,
+		"from":       kwiFrom,
+		"до":         kwiTo,
+		"to":         kwiTo,
+		"вниз":       kwiDown,
+		"down":       kwiDown,
+		"downto":     kwiDownTo,
+		"шаг":        kwiStep,
+		"step":       kwiStep,
+		"повторять":  kwiRepeat,
+		"repeat":     kwiRepeat,
+		"until":      kwiUntil,
+	}
+
+	keywordPragmaKeys = []string{"слова", "keywords"}
+	// ключ названия набора в файле
+	keywordNameKeys = []string{"название", "name"}
+
+	// в украинском и казахском наборах, как и в русском, нет слов для
+	// downto и until: счёт вниз записывается двумя словами, 'вниз до' и
+	// 'төмен дейін', а условие цикла 'повторювати' и 'қайталау' — словами
+	// 'до' и 'дейін'
+	ukrainianKeywords = []TKeyword{
+		{kwiFunction, "функція"}, {kwiProcedure, "процедура"},
+		{kwiVariable, "змінні"},
+		{kwiBegin, "початок"}, {kwiEnd, "кінець"},
+		{kwiIf, "якщо"}, {kwiElse, "інакше"},
+		{kwiWhile, "поки"}, {kwiNOT, "не"},
+		{kwiAND, "і"}, {kwiOR, "або"}, {kwiXOR, "виключно"},
+		{kwiShl, "зсувл"}, {kwiShr, "зсувп"},
+		{kwiReturn, "повернути"},
+		{kwiFor, "для"}, {kwiFrom, "від"}, {kwiTo, "до"}, {kwiDown, "вниз"},
+		{kwiStep, "крок"}, {kwiRepeat, "повторювати"},
+	}
+
+	kazakhKeywords = []TKeyword{
+		{kwiFunction, "атқарым"}, {kwiProcedure, "рәсім"},
+		{kwiVariable, "айнымалылар"},
+		{kwiBegin, "басы"}, {kwiEnd, "соңы"},
+		{kwiIf, "егер"}, {kwiElse, "әйтпесе"},
+		{kwiWhile, "әзір"}, {kwiNOT, "емес"},
+		{kwiAND, "және"}, {kwiOR, "немесе"}, {kwiXOR, "айрықша"},
+		{kwiShl, "жылжсол"}, {kwiShr, "жылжоң"},
+		{kwiReturn, "қайтару"},
+		{kwiFor, "үшін"}, {kwiFrom, "бастап"}, {kwiTo, "дейін"},
+		{kwiDown, "төмен"}, {kwiStep, "қадам"}, {kwiRepeat, "қайталау"},
+	}
+)
+
+var (
+	EUnknownKeywords = newError("E110")
+	EKeywordFile     = newError("E111")
+)
+
+// зарегистрированные наборы по названиям в нижнем регистре
+var keywordSets = struct {
+	sync.RWMutex
+	byName map[string]*TKeywordSet
+}{byName: map[string]*TKeywordSet{}}
+
+// набор по умолчанию: русские и английские слова вместе
+var standardKeywords = keywordSetOf(keywordList, func(string) bool {
+	return true
+}, "стандартный", "standard")
+
+func init() {
+	RegisterKeywordSet(standardKeywords)
+	RegisterKeywordSet(keywordSetOf(keywordList, isCyrillicWord,
+		"русский", "russian"))
+	RegisterKeywordSet(keywordSetOf(keywordList, func(S string) bool {
+		return !isCyrillicWord(S)
+	}, "английский", "english"))
+	RegisterKeywordSet(keywordSetOf(ukrainianKeywords, nil,
+		"украинский", "українська", "ukrainian"))
+	RegisterKeywordSet(keywordSetOf(kazakhKeywords, nil,
+		"казахский", "қазақша", "kazakh"))
+}
+
+func isCyrillicWord(S string) bool {
+	for _, C := range S {
+		if unicode.Is(unicode.Cyrillic, C) {
+			return true
+		}
+	}
+	return false
+}
+
+// Создаёт набор из слов AList, для которых AFilter возвращает истину
+func keywordSetOf(AList []TKeyword, AFilter func(string) bool,
+	ANames ...string) *TKeywordSet {
+	S := NewKeywordSet(ANames...)
+	for _, K := range AList {
+		if K.Id != kwiUnknown && (AFilter == nil || AFilter(K.Name)) {
+			S.add(K.Id, K.Name)
+		}
+	}
+	return S
+}
+
+func NewKeywordSet(ANames ...string) *TKeywordSet {
+	return &TKeywordSet{Names: ANames, words: map[string]TKeywordId{},
+		preferred: map[TKeywordId]string{}}
+}
+
+func (self *TKeywordSet) add(AId TKeywordId, AWord string) {
+	self.words[AWord] = AId
+	if _, ok := self.preferred[AId]; !ok {
+		self.preferred[AId] = AWord
+	}
+}
+
+/*
+ Добавляет слова AWords для понятия AConcept, например
+ Add("если", "якщо"). Первое добавленное слово понятия считается основным.
+ Возвращает ложь, если понятие неизвестно.
+*/
+func (self *TKeywordSet) Add(AConcept string, AWords ...string) bool {
+	id, ok := keywordConcepts[strings.ToLower(AConcept)]
+	if !ok {
+		return false
+	}
+	for _, W := range AWords {
+		self.add(id, W)
+	}
+	return true
+}
+
+// Возвращает номер зарезервированного слова или kwiUnknown
+func (self *TKeywordSet) Id(S string) TKeywordId {
+	return self.words[S]
+}
+
+// Возвращает основное слово понятия AId или пустую строку
+func (self *TKeywordSet) Word(AId TKeywordId) string {
+	return self.preferred[AId]
+}
+
+/*
+ Регистрирует набор под всеми его названиями, регистр букв не учитывается.
+ После регистрации набор не должен изменяться, так как его могут читать
+ одновременно несколько переводов.
+*/
+func RegisterKeywordSet(ASet *TKeywordSet) {
+	keywordSets.Lock()
+	defer keywordSets.Unlock()
+	for _, name := range ASet.Names {
+		keywordSets.byName[strings.ToLower(name)] = ASet
+	}
+}
+
+// Возвращает зарегистрированный набор или nil
+func KeywordSetByName(AName string) *TKeywordSet {
+	keywordSets.RLock()
+	defer keywordSets.RUnlock()
+	return keywordSets.byName[strings.ToLower(strings.TrimSpace(AName))]
+}
+
+/*
+ Загружает набор из текста вида:
+ # комментарий
+ название = украинский, ukrainian
+ функция = функція, процедура
+ Слева от '=' — понятие (функция, переменные, начало, конец, если, иначе,
+ пока, не, и, или, искл, сдвл, сдвп, процедура, вернуть, для, от, до, вниз,
+ downto, шаг, повторять, until или их английские названия), справа — слова
+ через запятую.
+ Ошибка EKeywordFile указывает номер строки, начиная с 0.
+*/
+func LoadKeywordSet(AReader io.Reader) (*TKeywordSet, error) {
+	S := NewKeywordSet()
+	scanner := bufio.NewScanner(AReader)
+	for lineNo := uint(0); scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, TPosition{LineNo: lineNo}.errorAt(EKeywordFile)
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		var words []string
+		for _, W := range strings.Split(line[i+1:], ",") {
+			if W = strings.TrimSpace(W); W != "" {
+				words = append(words, W)
+			}
+		}
+
+		isName := false
+		for _, K := range keywordNameKeys {
+			isName = isName || key == K
+		}
+		if isName {
+			S.Names = append(S.Names, words...)
+		} else if len(words) == 0 || !S.Add(key, words...) {
+			return nil, TPosition{LineNo: lineNo}.errorAt(EKeywordFile)
+		}
+	}
+	if E := scanner.Err(); E != nil {
+		return nil, E
+	}
+	return S, nil
+}
+
+// Загружает набор из файла, см. LoadKeywordSet
+func LoadKeywordSetFile(APath string) (*TKeywordSet, error) {
+	F, E := os.Open(APath)
+	if E != nil {
+		return nil, E
+	}
+	defer F.Close()
+	return LoadKeywordSet(F)
+}
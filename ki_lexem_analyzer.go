@@ -1,10 +1,18 @@
 package lsa
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/biorhitm/memfs"
 	"io"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -14,11 +22,16 @@ type TLexemType uint
 const (
 	ltUnknown TLexemType = iota
 	ltEOF
-	ltNumber // 12
+	ltNumber // 12 0x1F 0b1010 017 1_000
+	ltFloat  // 3.14 314E-2 3e+3
 	ltString // "test"
 	ltChar   // 'a' 'x' '%'
 	ltIdent  // имя функции, переменной или типа
 	ltEOL
+	// комментарий, хранится только в TLexem.Comments
+	ltComment
+	// неправильная последовательность UTF-8 в режиме UTF8Lenient
+	ltInvalidChar
 	ltExclamationMark   = '!'
 	ltQuote             = '"'
 	ltSharp             = '#'
@@ -52,15 +65,70 @@ const (
 	ltTilde             = '~'
 )
 
+// Операции из двух символов, номера начинаются после номеров символов
+const (
+	ltAboveOrEqual     TLexemType = iota + 256 // >=
+	ltBelowOrEqual                             // <=
+	ltNotEqual                                 // <>
+	ltLeftShift                                // <<
+	ltRightShift                               // >>
+	ltAssign                                   // :=
+	ltDoubleEqual                              // ==
+	ltExclamationEqual                         // !=
+	ltPlusAssign                               // +=
+	ltMinusAssign                              // -=
+	ltStarAssign                               // *=
+	ltSlashAssign                              // /=
+	ltPower                                    // **
+	ltRange                                    // ..
+	ltLogicalAnd                               // &&
+	ltLogicalOr                                // ||
+)
+
+var twoCharOperators = map[[2]rune]TLexemType{
+	{'>', '='}: ltAboveOrEqual,
+	{'<', '='}: ltBelowOrEqual,
+	{'<', '>'}: ltNotEqual,
+	{'<', '<'}: ltLeftShift,
+	{'>', '>'}: ltRightShift,
+	{':', '='}: ltAssign,
+	{'=', '='}: ltDoubleEqual,
+	{'!', '='}: ltExclamationEqual,
+	{'+', '='}: ltPlusAssign,
+	{'-', '='}: ltMinusAssign,
+	{'*', '='}: ltStarAssign,
+	{'/', '='}: ltSlashAssign,
+	{'*', '*'}: ltPower,
+	{'.', '.'}: ltRange,
+	{'&', '&'}: ltLogicalAnd,
+	{'|', '|'}: ltLogicalOr,
+}
+
 const (
 	LF = 0xA // LineFeed
+	CR = 0xD // CarriageReturn
 )
 
 type lsaError struct {
+	// постоянный код ошибки, например E201
+	Code     string
 	Msg      string
 	LineNo   uint
 	ColumnNo uint
 	Keyword  uint
+	// смещение в байтах от начала текста, если известно
+	Offset uint64
+	// участок текста, в котором найдена ошибка
+	Span TSpan
+}
+
+// Значение числовой константы
+type TNumberValue struct {
+	IsFloat bool
+	Int     int64
+	Float   float64
+	// не nil, если целое число не помещается в int64
+	Big *big.Int
 }
 
 type TLexem struct {
@@ -70,10 +138,31 @@ type TLexem struct {
 	Type     TLexemType
 	LineNo   uint
 	ColumnNo uint
+	// значение для лексем ltNumber и ltFloat
+	Number TNumberValue
+	// раскодированный текст для лексем ltString и ltChar
+	Value string
+	// комментарии перед лексемой, если установлен TReader.KeepComments
+	Comments PLexem
+	// смещение текста лексемы в байтах от начала текста, у строк и
+	// символов текст начинается после кавычки
+	Offset uint64
+	// участок текста, занимаемый лексемой, вместе с кавычками
+	Span TSpan
+	// текст лексемы, если TReader создан без memfs, тогда Text = nil
+	OwnedText string
 }
 
 type PLexem *TLexem
 
+/*
+ Читает лексемы из текста программы.
+ Если TReader заполнен напрямую полями Text и Size, то текст не копируется и
+ лексемы ссылаются на него через TLexem.Text, поэтому Text должен
+ существовать, пока используются лексемы. Функции NewReader, NewBytesReader и
+ NewFileReader создают TReader, лексемы которого владеют своим текстом
+ (TLexem.OwnedText).
+*/
 type TReader struct {
 	Text      memfs.PBigByteArray
 	Size      uint64
@@ -81,18 +170,98 @@ type TReader struct {
 	NextIndex uint64
 	LineNo    uint
 	ColumnNo  uint
+	// номер колонки в кодовых единицах UTF-16
+	Column16 uint
+	// сохранять комментарии в списке TLexem.Comments следующей лексемы,
+	// иначе комментарии пропускаются
+	KeepComments bool
+	// обработка неправильных последовательностей UTF-8
+	UTF8Mode TUTF8Mode
+	// неправильные последовательности UTF-8, найденные в режиме
+	// UTF8Strict; после них чтение продолжается
+	Errors []error
+	// кодировка текста, если не UTF-8, то перед чтением текст
+	// перекодируется и лексемы получают OwnedText
+	Encoding TEncoding
+	// ширина табуляции для номеров колонок, если 0, то табуляция
+	// занимает одну колонку
+	TabWidth uint
+	// набор зарезервированных слов, если nil, то стандартный; может быть
+	// задан прагмой '//# слова = ...' перед первой лексемой
+	Keywords *TKeywordSet
+	// комментарии, ещё не присоединённые к лексеме
+	comments    PLexem
+	lastComment PLexem
+	// читаемый текст, в режиме memfs указывает на Text, иначе на байты
+	// source; только для чтения
+	buf []byte
+	// собственная копия текста, на которую ссылаются OwnedText лексем
+	source string
+	// последний прочитанный символ - замена неправильной
+	// последовательности в режиме UTF8Lenient
+	invalidRune bool
+	prepared    bool
+	// текст уже перекодирован в UTF-8
+	transcoded bool
+	// прочитана первая лексема, кроме концов строк
+	started bool
+	// последняя возвращённая лексема - конец строки
+	afterEOL bool
 }
 
+type TUTF8Mode uint
+
+const (
+	// неправильные байты пропускаются
+	UTF8Skip TUTF8Mode = iota
+	// каждая неправильная последовательность записывается в
+	// TReader.Errors как ошибка EInvalidUTF8 и пропускается, в конце текста
+	// возвращается первая из них
+	UTF8Strict
+	// каждый неправильный байт заменяется символом U+FFFD, вне строк и
+	// символов для него создаётся лексема ltInvalidChar
+	UTF8Lenient
+)
+
 var (
-	EUnterminatedString = &lsaError{Msg: "Незакрытая строка, ожидается \""}
-	EUnterminatedChar   = &lsaError{Msg: "Незакрытый символ, ожидается '"}
+	EUnterminatedString  = newError("E101")
+	EUnterminatedChar    = newError("E102")
+	EInvalidNumber       = newError("E103")
+	ENumberOverflow      = newError("E104")
+	EInvalidEscape       = newError("E105")
+	ECharLength          = newError("E106")
+	EUnterminatedComment = newError("E107")
+	EInvalidUTF8         = newError("E108")
 )
 
 func (e *lsaError) Error() string {
 	return fmt.Sprintf("[%v:%v] %v", e.LineNo, e.ColumnNo, e.Msg)
 }
 
+/*
+ Каждая найденная ошибка — новое значение, копия одной из ошибок пакета,
+ поэтому несколько текстов можно переводить одновременно. С ошибкой пакета
+ она сравнивается по коду: errors.Is(E, EUnterminatedString)
+*/
+func (e *lsaError) Is(ATarget error) bool {
+	T, ok := ATarget.(*lsaError)
+	return ok && T.Code != "" && T.Code == e.Code
+}
+
+// Возвращает код ошибки пакета или пустую строку для других ошибок
+func ErrorCode(E error) string {
+	var lsaE *lsaError
+	if errors.As(E, &lsaE) {
+		return lsaE.Code
+	}
+	return ""
+}
+
 func (self *TLexem) LexemAsString() string {
+	if self.Text == nil {
+		return self.OwnedText
+	}
+
 	S := ""
 
 	if self.Size > 0 && self.Text != nil {
@@ -106,8 +275,9 @@ func (self *TLexem) LexemAsString() string {
 	return S
 }
 
+// Буквы латиницы и кириллицы, включая украинские и казахские буквы
 func isLetter(C rune) bool {
-	return (0x0410 <= C && C <= 0x044F) || C == 0x0401 || C == 0x0451 ||
+	return (0x0400 <= C && C <= 0x04FF && unicode.IsLetter(C)) ||
 		('A' <= C && C <= 'Z') || ('a' <= C && C <= 'z')
 }
 
@@ -134,148 +304,581 @@ func isSymbol(C rune) bool {
 		(123 <= C && C <= 126)
 }
 
-var InvalidRune = errors.New("Invalid utf8 char, support russian only")
+// Знак порядка байтов, с которого может начинаться текст
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
 
-//TODO: сделать peekRune
-func (R *TReader) readRune() (aChar rune, E error) {
+// Ошибка в режиме UTF8Strict, то же что EInvalidUTF8
+var InvalidRune error = EInvalidUTF8
 
-	if R.NextIndex > R.Index {
+// Возвращает байты строки S без копирования; изменять их нельзя
+func stringBytes(S string) []byte {
+	return unsafe.Slice(unsafe.StringData(S), len(S))
+}
+
+// Создаёт TReader, который читает строку S, не копируя её
+func newStringReader(S string) *TReader {
+	return &TReader{
+		Size:   uint64(len(S)),
+		buf:    stringBytes(S),
+		source: S,
+	}
+}
+
+// Читает весь текст из AReader в строку, ASize - ожидаемый размер текста
+func readString(AReader io.Reader, ASize int) (string, error) {
+	var B strings.Builder
+	B.Grow(ASize)
+	if _, err := io.Copy(&B, AReader); err != nil {
+		return "", err
+	}
+	return B.String(), nil
+}
+
+// Создаёт TReader для текста AData. Текст один раз копируется в память
+// анализатора, поэтому после вызова AData можно изменять
+func NewBytesReader(AData []byte) *TReader {
+	return newStringReader(string(AData))
+}
+
+// Создаёт TReader для текста из AReader. Это не потоковое чтение: весь
+// текст сразу читается в память
+func NewReader(AReader io.Reader) (*TReader, error) {
+	text, err := readString(AReader, 0)
+	if err != nil {
+		return nil, err
+	}
+	return newStringReader(text), nil
+}
+
+// Создаёт TReader для текста из файла AFileName. Весь файл сразу читается
+// в память
+func NewFileReader(AFileName string) (*TReader, error) {
+	F, err := os.Open(AFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer F.Close()
+
+	size := 0
+	if info, err := F.Stat(); err == nil {
+		size = int(info.Size())
+	}
+	text, err := readString(F, size)
+	if err != nil {
+		return nil, err
+	}
+	return newStringReader(text), nil
+}
+
+// Записывает в лексему её текст, начиная с L.Offset длиной L.Size байт
+func (R *TReader) setLexemText(L *TLexem) {
+	if L.Size == 0 {
+		return
+	}
+	if R.Text != nil {
+		L.Text = memfs.PBigByteArray(unsafe.Pointer(&R.Text[L.Offset]))
+	} else {
+		L.OwnedText = R.source[L.Offset : L.Offset+uint64(L.Size)]
+	}
+}
+
+// Подготавливает текст к чтению, перекодируя его при необходимости
+func (R *TReader) prepare() {
+	R.prepared = true
+	if R.buf == nil && R.Text != nil {
+		R.buf = R.Text[:R.Size:R.Size]
+	}
+
+	E := R.Encoding
+	if E == EncodingAuto {
+		E = DetectEncoding(R.buf)
+	}
+	if E != EncodingUTF8 {
+		R.transcode(0, E)
+	}
+}
+
+/*
+ Возвращает текст, который читает анализатор, после перекодирования в UTF-8.
+ Если кодировка указана прагмой, то текст перекодируется при чтении прагмы,
+ поэтому SourceText надо вызывать после разбора на лексемы.
+*/
+func (R *TReader) SourceText() string {
+	if !R.prepared {
+		R.prepare()
+	}
+	if R.Text == nil {
+		return R.source
+	}
+	return string(R.buf)
+}
+
+/*
+ Перекодирует текст в UTF-8, начиная со смещения AFrom. Дальше лексемы
+ ссылаются на перекодированную копию текста, а не на Text.
+*/
+func (R *TReader) transcode(AFrom uint64, AEncoding TEncoding) {
+	decoded := DecodeText(R.buf[AFrom:], AEncoding)
+	var B strings.Builder
+	B.Grow(int(AFrom) + len(decoded))
+	B.Write(R.buf[:AFrom])
+	B.Write(decoded)
+
+	R.source = B.String()
+	R.buf = stringBytes(R.source)
+	R.Size = uint64(len(R.source))
+	R.Text = nil
+	R.transcoded = true
+}
+
+// Переходит к следующему символу после прочитанного, считая строки и колонки
+func (R *TReader) step() {
+	switch R.buf[R.Index] {
+	case LF, CR:
+		R.ColumnNo = 0
+		R.Column16 = 0
+		R.LineNo++
+	case '\t':
+		if R.TabWidth > 0 {
+			R.ColumnNo = (R.ColumnNo/R.TabWidth + 1) * R.TabWidth
+		} else {
+			R.ColumnNo++
+		}
+		R.Column16++
+	default:
 		R.ColumnNo++
-		if R.Text[R.Index] == LF {
-			R.ColumnNo = 0
-			R.LineNo++
+		// символы из 4 байт в UTF-16 занимают 2 кодовые единицы
+		if R.NextIndex-R.Index == 4 {
+			R.Column16 += 2
+		} else {
+			R.Column16++
 		}
-		R.Index = R.NextIndex
 	}
+	R.Index = R.NextIndex
+}
 
-	if R.Index >= R.Size {
-		return 0, io.EOF
+// Положение текущего символа
+func (R *TReader) position() TPosition {
+	return TPosition{LineNo: R.LineNo, ColumnNo: R.ColumnNo,
+		Column16: R.Column16, Offset: R.Index}
+}
+
+// Положение после прочитанного символа
+func (R *TReader) positionAfter() TPosition {
+	T := *R
+	if T.NextIndex > T.Index {
+		T.step()
 	}
+	return T.position()
+}
 
-	size := uint(1)
-	ok := false
+//TODO: сделать peekRune
+/*
+ Читает следующий символ. Концы строк CR LF и CR возвращаются как LF.
+ Неправильные последовательности UTF-8
+ обрабатываются в зависимости от R.UTF8Mode: пропускаются, пропускаются с
+ ошибкой EInvalidUTF8 в R.Errors или заменяются символом U+FFFD. Знак
+ порядка байтов в начале текста пропускается.
+*/
+func (R *TReader) readRune() (aChar rune, E error) {
+	if !R.prepared {
+		R.prepare()
+	}
 
-	for !ok {
-		B := R.Text[R.Index]
+	if R.NextIndex > R.Index {
+		R.step()
+	} else if R.Index == 0 && bytes.HasPrefix(R.buf, utf8BOM) {
+		R.Index = uint64(len(utf8BOM))
+	}
+	R.invalidRune = false
 
-		if B&0x80 != 0 { //first or next byte utf-8 sequence longer than 1 byte
-			B <<= 1
-			sequenceLen := uint(1)
-			for ; B&0x80 != 0; B <<= 1 {
-				sequenceLen++
-			}
+	invalid := false
+	for {
+		if R.Index >= R.Size {
+			return 0, io.EOF
+		}
 
-			if sequenceLen < 2 {
-				// курсор указывает не на начало последовательности
-				R.Index++
-				if R.Index >= R.Size {
-					return 0, io.EOF
-				}
-				continue
-			}
-			if sequenceLen > 4 {
-				// курсор указывает на неправильную последовательность
-				R.Index++
-				if R.Index >= R.Size {
-					return 0, io.EOF
+		var size int
+		aChar, size = utf8.DecodeRune(R.buf[R.Index:])
+		if aChar != utf8.RuneError || size > 1 {
+			// концы строк CR LF и CR читаются как LF
+			if aChar == CR {
+				aChar = LF
+				if R.Index+1 < R.Size && R.buf[R.Index+1] == LF {
+					size = 2
 				}
-				continue
 			}
-			if R.Index+uint64(sequenceLen)-1 >= R.Size {
-				// последовательность не помещается в буфер
-				return 0, io.EOF
+			R.NextIndex = R.Index + uint64(size)
+			return aChar, nil
+		}
+
+		// неправильная последовательность
+		switch R.UTF8Mode {
+		case UTF8Strict:
+			// идущие подряд неправильные байты - одна последовательность
+			if !invalid {
+				R.Errors = append(R.Errors, R.position().errorAt(EInvalidUTF8))
 			}
+			invalid = true
 
-			aChar = rune(B >> sequenceLen)
-			ok = true
+		case UTF8Lenient:
+			R.invalidRune = true
+			R.NextIndex = R.Index + 1
+			return utf8.RuneError, nil
+		}
 
-			for i := uint(1); i < sequenceLen; i++ {
-				B = R.Text[R.Index+uint64(i)]
+		// байт пропускается
+		R.Index++
+	}
+}
 
-				// если в старших двух битах B число 2(10xxx xxxx), то это
-				// продолжение последовательности, иначе неправильная
-				// последовательность
-				if B&0xC0 == 0x80 {
-					aChar = aChar<<6 | rune(B&0x3F)
-				} else {
-					R.Index++
-					if R.Index >= R.Size {
-						return 0, io.EOF
-					}
-					ok = false
-					break
-				}
-			}
-			if ok {
-				size = sequenceLen
-			}
+func (R *TReader) unread() {
+	R.NextIndex = R.Index
+}
 
-		} else {
-			aChar = rune(B)
-			ok = true
+func isHexDigit(C rune) bool {
+	return isDigit(C) || ('a' <= C && C <= 'f') || ('A' <= C && C <= 'F')
+}
+
+func hexDigitValue(C rune) rune {
+	switch {
+	case isDigit(C):
+		return C - '0'
+	case 'a' <= C && C <= 'f':
+		return C - 'a' + 10
+	}
+	return C - 'A' + 10
+}
+
+func isOctalDigit(C rune) bool {
+	return '0' <= C && C <= '7'
+}
+
+func isBinaryDigit(C rune) bool {
+	return C == '0' || C == '1'
+}
+
+// Возвращает число в виде текста в десятичной системе счисления, у чисел
+// с плавающей точкой всегда есть точка или порядок
+func (self TNumberValue) String() string {
+	if !self.IsFloat {
+		if self.Big != nil {
+			return self.Big.String()
 		}
+		return strconv.FormatInt(self.Int, 10)
 	}
 
-	R.NextIndex = R.Index + uint64(size)
-	return aChar, nil
+	S := strconv.FormatFloat(self.Float, 'g', -1, 64)
+	if !strings.ContainsAny(S, ".eIN") {
+		S += ".0"
+	}
+	return S
 }
 
-func (R *TReader) unread() {
-	R.NextIndex = R.Index
+// Возвращает истину, если число больше нуля
+func (self TNumberValue) IsPositive() bool {
+	switch {
+	case self.IsFloat:
+		return self.Float > 0
+	case self.Big != nil:
+		return self.Big.Sign() > 0
+	}
+	return self.Int > 0
 }
 
-func (self *TReader) extractNumber(ALexem *TLexem) error {
-	//TODO: проверка первого символа
-	//TODO: анализ чисел 16-ричных(0x...)
-	//TODO: анализ чисел 2-ичных(0b...)
-	//TODO: анализ чисел 8-ричных(0...)
-	//TODO: анализ чисел c E(314E-2, 3e+3)
-
-	var C rune
-	var err error
-	startIndex := self.Index
-	ALexem.Text = memfs.PBigByteArray(unsafe.Pointer(&self.Text[startIndex]))
+// Возвращает число с противоположным знаком
+func (self TNumberValue) Neg() TNumberValue {
+	switch {
+	case self.IsFloat:
+		self.Float = -self.Float
+	case self.Big != nil:
+		self.Big = new(big.Int).Neg(self.Big)
+		// -9223372036854775808 помещается в int64
+		if self.Big.IsInt64() {
+			self.Int, self.Big = self.Big.Int64(), nil
+		}
+	case self.Int == math.MinInt64:
+		self.Big = new(big.Int).Neg(big.NewInt(self.Int))
+	default:
+		self.Int = -self.Int
+	}
+	return self
+}
+
+/*
+ Читает цифры, разрешённые функцией AIsDigit, и дописывает их в ADigits.
+ Между цифрами может стоять разделитель '_': 1_000_000.
+ Возвращает кол-во прочитанных цифр.
+*/
+func (self *TReader) readDigits(ADigits *strings.Builder,
+	AIsDigit func(rune) bool) (count int, E error) {
+	wasSeparator := false
 
 	for {
-		C, err = self.readRune()
-		if err == nil {
-			if !isDigit(C) {
-				break
-			}
-		} else {
+		C, err := self.readRune()
+		if err != nil {
 			if err == io.EOF {
-				ALexem.Size = uint(self.Index - startIndex)
 				break
 			}
-			return err
+			return count, err
+		}
+
+		if AIsDigit(C) {
+			ADigits.WriteRune(C)
+			count++
+			wasSeparator = false
+			continue
+		}
+
+		if C == '_' && count > 0 && !wasSeparator {
+			wasSeparator = true
+			continue
+		}
+
+		self.unread()
+		break
+	}
+
+	if wasSeparator {
+		// разделитель должен стоять между цифрами
+		return count, EInvalidNumber
+	}
+	return count, nil
+}
+
+/*
+ Читает AMaxCount 16-ричных цифр, если AExact ложь, то цифр может быть
+ меньше, но не меньше одной.
+*/
+func (R *TReader) readHexCode(AMaxCount int, AExact bool) (code rune,
+	ok bool, E error) {
+	count := 0
+	for count < AMaxCount {
+		C, err := R.readRune()
+		if err != nil {
+			return 0, false, err
+		}
+		if !isHexDigit(C) {
+			R.unread()
+			break
+		}
+		code = code<<4 | hexDigitValue(C)
+		count++
+	}
+	ok = count == AMaxCount || (!AExact && count > 0)
+	return code, ok, nil
+}
+
+/*
+ Читает один символ строки или символьной константы, раскрывая
+ спец. последовательности:
+   \a \b \f \n \r \t \v \0 \\ \' \" \xHH \u{H...H}
+ raw - истина, если C — байт \xHH, который, как в СИ, записывается в строку
+ как есть, а не как символ UTF-8: "\xFF" — один байт 0xFF
+ closed - истина, если прочитана закрывающая кавычка AQuote
+*/
+func (R *TReader) readLiteralRune(AQuote rune) (C rune, raw, closed bool,
+	E error) {
+	if C, E = R.readRune(); E != nil {
+		return 0, false, false, E
+	}
+	if C == AQuote {
+		return C, false, true, nil
+	}
+	if C != 0x5C {
+		return C, false, false, nil
+	}
+
+	// положение обратной косой черты, для сообщения об ошибке
+	pos := R.position()
+	if C, E = R.readRune(); E != nil {
+		return 0, false, false, E
+	}
+
+	switch C {
+	case 'a':
+		return 7, false, false, nil
+	case 'b':
+		return 8, false, false, nil
+	case 'f':
+		return 0xC, false, false, nil
+	case 'n':
+		return LF, false, false, nil
+	case 'r':
+		return 0xD, false, false, nil
+	case 't':
+		return 9, false, false, nil
+	case 'v':
+		return 0xB, false, false, nil
+	case '0':
+		return 0, false, false, nil
+	case 0x5C, 0x27, '"':
+		return C, false, false, nil
+
+	case 'x':
+		code, ok, err := R.readHexCode(2, true)
+		if err != nil {
+			return 0, false, false, err
+		}
+		if ok {
+			return code, true, false, nil
+		}
+
+	case 'u':
+		if C, E = R.readRune(); E != nil {
+			return 0, false, false, E
+		}
+		if C != '{' {
+			break
+		}
+		code, ok, err := R.readHexCode(6, false)
+		if err != nil {
+			return 0, false, false, err
+		}
+		if C, E = R.readRune(); E != nil {
+			return 0, false, false, E
+		}
+		if ok && C == '}' && utf8.ValidRune(code) {
+			return code, false, false, nil
 		}
 	}
 
-	if C == '.' {
-		//пока просто пропускаю
+	return 0, false, false, pos.errorAt(EInvalidEscape)
+}
+
+/*
+ Читает число и записывает его значение в ALexem.Number
+ ЧИСЛО = <ЦЕЛОЕ> | <ПЛАВАЮЩЕЕ>
+ ЦЕЛОЕ = <ДЕСЯТИЧНЫЕ ЦИФРЫ> | '0' ('x' | 'X') <16-РИЧНЫЕ ЦИФРЫ>
+   | '0' ('b' | 'B') <2-ИЧНЫЕ ЦИФРЫ> | '0' ('o' | 'O') <8-РИЧНЫЕ ЦИФРЫ>
+   | '0' <8-РИЧНЫЕ ЦИФРЫ>
+ ПЛАВАЮЩЕЕ = <ДЕСЯТИЧНЫЕ ЦИФРЫ> '.' <ДЕСЯТИЧНЫЕ ЦИФРЫ> [<ПОРЯДОК>]
+   | <ДЕСЯТИЧНЫЕ ЦИФРЫ> <ПОРЯДОК>
+ ПОРЯДОК = ('e' | 'E') ['+' | '-'] <ДЕСЯТИЧНЫЕ ЦИФРЫ>
+ Между цифрами может стоять разделитель '_'. После '.' обязательно должна
+ идти цифра, чтобы "1..10" читалось как 1 .. 10
+*/
+func (self *TReader) extractNumber(ALexem *TLexem) error {
+	var (
+		C      rune
+		err    error
+		count  int
+		digits strings.Builder
+	)
+	startIndex := self.Index
+
+	base := 10
+	isDigitOfBase := isDigit
+	isFloat := false
+
+	C, _ = self.readRune()
+	if C == '0' {
+		C, err = self.readRune()
+		switch {
+		case err != nil:
+		case C == 'x' || C == 'X':
+			base, isDigitOfBase = 16, isHexDigit
+		case C == 'b' || C == 'B':
+			base, isDigitOfBase = 2, isBinaryDigit
+		case C == 'o' || C == 'O':
+			base, isDigitOfBase = 8, isOctalDigit
+		}
+		if err == nil && base == 10 {
+			self.unread()
+		}
+		if base == 10 {
+			digits.WriteRune('0')
+		}
 	} else {
 		self.unread()
-		ALexem.Size = uint(self.Index - startIndex)
-		return nil
 	}
 
-	for {
-		C, err = self.readRune()
-		if err == nil {
-			if !isDigit(C) {
+	if count, err = self.readDigits(&digits, isDigitOfBase); err != nil {
+		return ALexem.errorAt(EInvalidNumber)
+	}
+	if base != 10 && count == 0 {
+		// после префикса нет ни одной цифры: "0x"
+		return ALexem.errorAt(EInvalidNumber)
+	}
+
+	if base == 10 {
+		// дробная часть, точку без цифры после неё оставляю
+		saved := *self
+		if C, err = self.readRune(); err == nil && C == '.' {
+			digits.WriteRune('.')
+			if count, err = self.readDigits(&digits, isDigit); err != nil {
+				return ALexem.errorAt(EInvalidNumber)
+			}
+			if count == 0 {
+				*self = saved
+				S := digits.String()
+				digits.Reset()
+				digits.WriteString(S[:len(S)-1])
+			} else {
+				isFloat = true
+			}
+		} else if err == nil {
+			self.unread()
+		}
+
+		// порядок
+		if C, err = self.readRune(); err == nil && (C == 'e' || C == 'E') {
+			digits.WriteRune('e')
+			if C, err = self.readRune(); err == nil && (C == '+' || C == '-') {
+				digits.WriteRune(C)
+			} else if err == nil {
 				self.unread()
-				break
 			}
-		} else {
-			if err == io.EOF {
-				break
+			count, err = self.readDigits(&digits, isDigit)
+			if err != nil || count == 0 {
+				return ALexem.errorAt(EInvalidNumber)
 			}
-			return err
+			isFloat = true
+		} else if err == nil {
+			self.unread()
+		}
+
+		// старый формат 8-ричных чисел: 017
+		S := digits.String()
+		if !isFloat && len(S) > 1 && S[0] == '0' {
+			for _, C := range S {
+				if !isOctalDigit(C) {
+					return ALexem.errorAt(EInvalidNumber)
+				}
+			}
+			base = 8
 		}
 	}
 
+	// сразу после числа не может идти буква или цифра: 12abc, 0b102
+	if C, err = self.readRune(); err == nil {
+		self.unread()
+		if isIdentLetter(C) || isDigit(C) {
+			return ALexem.errorAt(EInvalidNumber)
+		}
+	} else if err != io.EOF {
+		return err
+	}
 	ALexem.Size = uint(self.Index - startIndex)
 
+	S := digits.String()
+	if isFloat {
+		ALexem.Type = ltFloat
+		ALexem.Number.IsFloat = true
+		ALexem.Number.Float, err = strconv.ParseFloat(S, 64)
+		if err != nil {
+			return ALexem.errorAt(ENumberOverflow)
+		}
+		return nil
+	}
+
+	ALexem.Number.Int, err = strconv.ParseInt(S, base, 64)
+	if err != nil {
+		// число не помещается в int64
+		ALexem.Number.Int = 0
+		ALexem.Number.Big, _ = new(big.Int).SetString(S, base)
+	}
+
 	return nil
 }
 
@@ -289,12 +892,15 @@ func (R *TReader) createNewLexem(parent PLexem, _type TLexemType) (PLexem, error
 	L.Text = nil
 	L.LineNo = R.LineNo
 	L.ColumnNo = R.ColumnNo
+	L.Offset = R.Index
+	L.Span.Start = R.position()
+	L.Comments = R.comments
+	R.comments, R.lastComment = nil, nil
 
 	switch _type {
 	case ltIdent:
 		{
 			startIndex = R.Index
-			L.Text = memfs.PBigByteArray(unsafe.Pointer(&R.Text[R.Index]))
 			for {
 				C, err := R.readRune()
 				if err != nil {
@@ -326,112 +932,289 @@ func (R *TReader) createNewLexem(parent PLexem, _type TLexemType) (PLexem, error
 	case ltString:
 		{
 			startIndex = R.NextIndex
-			L.Text = memfs.PBigByteArray(unsafe.Pointer(&R.Text[startIndex]))
+			L.Offset = startIndex
+			var value strings.Builder
 			for {
-				C, err := R.readRune()
+				C, raw, closed, err := R.readLiteralRune('"')
 				if err != nil {
 					if err == io.EOF {
-						E := EUnterminatedString
-						E.LineNo = L.LineNo
-						E.ColumnNo = L.ColumnNo
-						err = E
+						err = L.errorAt(EUnterminatedString)
 					}
 					return nil, err
 				}
-				if C == '"' {
+				if closed {
 					L.Size = uint(R.Index - startIndex)
 					break
 				}
+				if raw {
+					value.WriteByte(byte(C))
+				} else {
+					value.WriteRune(C)
+				}
 			}
+			L.Value = value.String()
 		}
 
 	case ltChar:
 		{
 			startIndex = R.NextIndex
-			L.Text = memfs.PBigByteArray(unsafe.Pointer(&R.Text[startIndex]))
-			//TODO заменить на вызов чтения символа, разрулить спец. послед.
+			L.Offset = startIndex
+			count := 0
 			for {
-				C, err := R.readRune()
+				C, raw, closed, err := R.readLiteralRune(0x27)
 				if err != nil {
 					if err == io.EOF {
-						E := EUnterminatedChar
-						E.LineNo = L.LineNo
-						E.ColumnNo = L.ColumnNo
-						err = E
+						err = L.errorAt(EUnterminatedChar)
 					}
 					return nil, err
 				}
-				if C == 0x27 {
+				if closed {
 					L.Size = uint(R.Index - startIndex)
 					break
 				}
+				if raw {
+					L.Value = string([]byte{byte(C)})
+				} else {
+					L.Value = string(C)
+				}
+				count++
+			}
+			if count != 1 {
+				return nil, L.errorAt(ECharLength)
 			}
 		}
 	}
 
+	R.setLexemText(L)
+	L.Span.End = R.positionAfter()
 	if parent != nil {
 		parent.Next = L
 	}
 	return L, nil
 }
 
-func (R *TReader) BuildLexems() (PLexem, error) {
-	var curLexem, firstLexem PLexem
+/*
+ Создаёт лексему операции, первый символ AFirst которой уже прочитан.
+ Если вместе со следующим символом получается операция из twoCharOperators,
+ то лексема состоит из двух символов, иначе код символа будет типом лексемы.
+ Символы операции должны идти подряд: "> =" - это две лексемы.
+*/
+func (R *TReader) createOperatorLexem(parent PLexem, AFirst rune) (PLexem,
+	error) {
+	saved := *R
+	C, err := R.readRune()
+	*R = saved
+	if err != nil {
+		return R.createNewLexem(parent, TLexemType(AFirst))
+	}
 
-	curLexem = new(TLexem)
-	firstLexem = curLexem
+	T, ok := twoCharOperators[[2]rune{AFirst, C}]
+	if !ok {
+		return R.createNewLexem(parent, TLexemType(AFirst))
+	}
 
-	for {
+	L, err := R.createNewLexem(parent, T)
+	if err != nil {
+		return nil, err
+	}
+	L.Size = 2
+	R.setLexemText(L)
+	// второй символ операции
+	_, err = R.readRune()
+	L.Span.End = R.positionAfter()
+	return L, err
+}
+
+/*
+ Читает комментарий, начало которого уже прочитано
+ КОММЕНТАРИЙ = '//' <ЛЮБЫЕ СИМВОЛЫ ДО КОНЦА СТРОКИ>
+   | '/*' {<ЛЮБЫЕ СИМВОЛЫ> | <КОММЕНТАРИЙ>} '*' '/'
+ Блочные комментарии могут быть вложенными.
+ AStart - состояние до чтения первого символа '/'
+*/
+func (R *TReader) readComment(AStart *TReader, ABlock bool) error {
+	L := &TLexem{
+		Type:     ltComment,
+		Offset:   AStart.Index,
+		LineNo:   AStart.LineNo,
+		ColumnNo: AStart.ColumnNo,
+		Span:     TSpan{Start: AStart.position()},
+	}
+
+	depth := 1
+	for depth > 0 {
 		C, err := R.readRune()
 		if err != nil {
+			if err == io.EOF && !ABlock {
+				break
+			}
 			if err == io.EOF {
+				err = L.errorAt(EUnterminatedComment)
+			}
+			return err
+		}
+
+		if !ABlock {
+			if C == LF {
+				// конец строки остаётся для лексемы ltEOL
+				R.unread()
 				break
 			}
+			continue
+		}
+
+		// возможное начало или конец вложенного комментария
+		if C == '/' || C == '*' {
+			next, err := R.readRune()
+			if err == nil {
+				switch {
+				case C == '/' && next == '*':
+					depth++
+				case C == '*' && next == '/':
+					depth--
+				default:
+					R.unread()
+				}
+			}
+		}
+	}
+
+	// прагма кодировки в первой строке
+	text := ""
+	if !ABlock {
+		text = string(R.buf[AStart.Index:R.NextIndex])
+	}
+	if !ABlock && !R.transcoded && AStart.LineNo == 0 {
+		if E, ok, known := encodingPragma(text); ok {
+			if !known {
+				return L.errorAt(EUnknownEncoding)
+			}
+			if E != EncodingUTF8 {
+				R.transcode(R.NextIndex, E)
+			}
+		}
+	}
+
+	// прагма ключевых слов перед первой лексемой
+	if !ABlock && !R.started {
+		if name, ok := pragmaValue(text, keywordPragmaKeys); ok {
+			if R.Keywords = KeywordSetByName(name); R.Keywords == nil {
+				return L.errorAt(EUnknownKeywords)
+			}
+		}
+	}
+
+	if R.KeepComments {
+		L.Span.End = R.positionAfter()
+		L.Size = uint(R.NextIndex - AStart.Index)
+		R.setLexemText(L)
+		if R.lastComment != nil {
+			R.lastComment.Next = L
+		} else {
+			R.comments = L
+		}
+		R.lastComment = L
+	}
+	return nil
+}
+
+/*
+ Читает следующую лексему. Лексемы создаются по одной, поэтому разбор
+ можно начинать, не дожидаясь чтения всего текста. В конце текста
+ возвращается лексема ltEOF, в том числе при повторных вызовах, а если в
+ R.Errors есть ошибки, то вместо неё возвращается первая из них.
+ Поле Next возвращённой лексемы не заполняется.
+*/
+func (R *TReader) NextLexem() (PLexem, error) {
+	L, E := R.nextLexem()
+	if E == nil && L.Type == ltEOF && len(R.Errors) > 0 {
+		return nil, R.Errors[0]
+	}
+	return L, E
+}
+
+func (R *TReader) nextLexem() (PLexem, error) {
+	for {
+		C, err := R.readRune()
+		if err != nil {
+			if err == io.EOF {
+				return R.createNewLexem(nil, ltEOF)
+			}
 			return nil, err
 		}
 
+		var L PLexem
+
 		switch {
 		case isIdentLetter(C):
 			{
 				R.unread()
-				curLexem, err = R.createNewLexem(curLexem, ltIdent)
+				L, err = R.createNewLexem(nil, ltIdent)
 			}
 
 		case isDigit(C):
 			{
 				R.unread()
-				curLexem, err = R.createNewLexem(curLexem, ltNumber)
+				L, err = R.createNewLexem(nil, ltNumber)
 			}
 
 		case C == '"':
 			{
-				curLexem, err = R.createNewLexem(curLexem, ltString)
+				L, err = R.createNewLexem(nil, ltString)
 			}
 
 		case C == 0x27: //single quote
 			{
-				curLexem, err = R.createNewLexem(curLexem, ltChar)
+				L, err = R.createNewLexem(nil, ltChar)
+			}
+
+		case C == '/':
+			{
+				// '/' может начинать комментарий
+				saved := *R
+				C, err = R.readRune()
+				if err == nil && (C == '/' || C == '*') {
+					err = R.readComment(&saved, C == '*')
+				} else {
+					*R = saved
+					L, err = R.createOperatorLexem(nil, '/')
+				}
 			}
 
 		case isSymbol(C):
 			{
-				// код символа будет типом лексемы
-				curLexem, err = R.createNewLexem(curLexem, TLexemType(C))
+				L, err = R.createOperatorLexem(nil, C)
+			}
+
+		case R.invalidRune:
+			{
+				L, err = R.createNewLexem(nil, ltInvalidChar)
+				L.Size = uint(R.NextIndex - R.Index)
+				R.setLexemText(L)
 			}
 
 		case C == 0x0A:
 			{
-				L, _ := R.createNewLexem(curLexem, ltEOL)
+				// строки из одного комментария, как и пустые строки, не
+				// дают второго конца строки подряд
+				if !R.afterEOL {
+					L, _ = R.createNewLexem(nil, ltEOL)
+				}
+				// пустые строки пропускаются, конец строки в конце текста
+				// не нужен
 				for {
 					C, err = R.readRune()
 					if err != nil {
 						if err == io.EOF {
-							break
+							EOF, _ := R.createNewLexem(nil, ltEOF)
+							if L != nil {
+								EOF.Comments = L.Comments
+							}
+							return EOF, nil
 						}
 						return nil, err
 					}
 					if C > ' ' {
-						curLexem = L
 						R.unread()
 						break
 					}
@@ -442,14 +1225,39 @@ func (R *TReader) BuildLexems() (PLexem, error) {
 		}
 
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
 			return nil, err
 		}
+		if L != nil {
+			if L.Type != ltEOL {
+				R.started = true
+			}
+			R.afterEOL = L.Type == ltEOL
+			return L, nil
+		}
 	}
+}
+
+// Читает все лексемы текста и возвращает первую из них
+func (R *TReader) BuildLexems() (PLexem, error) {
+	var firstLexem, curLexem PLexem
+
+	for {
+		L, err := R.NextLexem()
+		if err != nil {
+			return nil, err
+		}
 
-	R.createNewLexem(curLexem, ltEOF)
+		if curLexem == nil {
+			firstLexem = L
+		} else {
+			curLexem.Next = L
+		}
+		curLexem = L
+
+		if L.Type == ltEOF {
+			break
+		}
+	}
 
-	return firstLexem.Next, nil
+	return firstLexem, nil
 }
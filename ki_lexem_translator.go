@@ -1,7 +1,8 @@
 package lsa
 
 import (
-	"fmt"
+	"errors"
+	"strings"
 )
 
 type TLanguageItemType uint
@@ -47,6 +48,21 @@ const (
 	ltitElse
 	ltitWhile
 	ltitAddressOf
+	ltitCall
+	ltitComma
+	ltitBitAND
+	ltitBitOR
+	ltitBitXOR
+	ltitNegate
+	ltitUnaryPlus
+	ltitBitNOT
+	ltitReturn
+	ltitFor
+	ltitTo
+	ltitDownTo
+	ltitStep
+	ltitRepeat
+	ltitUntil
 )
 
 type TLanguageItem struct {
@@ -54,6 +70,8 @@ type TLanguageItem struct {
 	// идентификаторы будут держать здесь номер строки из массива
 	// всех идентификаторов
 	Index uint
+	// участок текста, из которого получен элемент
+	Span TSpan
 }
 
 type TStringArray []string
@@ -72,6 +90,34 @@ type TSyntaxDescriptor struct {
 	StrIdents     TStringArray
 	StrStrings    TStringArray
 	Keyword       TKeywordId
+	// значения чисел, индексы совпадают с индексами в StrNumbers
+	Numbers []TNumberValue
+	// синтаксическое дерево программы
+	Program *TProgram
+	// стек операндов для построения дерева выражения
+	Operands []TExpr
+	// если не nil, то лексемы читаются из него по мере перевода
+	Reader *TReader
+	// ошибка чтения лексем из Reader
+	ReadError error
+	// положение после последней пройденной лексемы, кроме конца строки
+	LastEnd TPosition
+	// все найденные при переводе ошибки и предупреждения
+	Diagnostics TDiagnostics
+	// начала открытых блоков, для пояснения к незакрытому блоку
+	Blocks []TSpan
+	// первая найденная ошибка, её возвращает TranslateCode
+	firstError error
+	// набор зарезервированных слов, если nil, то стандартный
+	Keywords *TKeywordSet
+	// переводимая функция, nil вне функций
+	function *TFuncDecl
+	// слова, зарезервированные в текущей части оператора, см. reserve
+	contextWords []TKeywordId
+	// если не nil, то для слов, зарезервированных только в части
+	// оператора, запоминается, каким словом они переведены: смещение
+	// лексемы -> номер слова; нужно для ConvertKeywords
+	contextUses map[uint64]TKeywordId
 }
 
 type TKeywordId uint
@@ -91,15 +137,31 @@ const (
 	kwiElse
 	kwiWhile
 	kwiNOT
+	kwiAND
+	kwiOR
+	kwiXOR
+	kwiShl
+	kwiShr
+	kwiProcedure
+	kwiReturn
+	kwiFor
+	kwiFrom
+	kwiTo
+	kwiDown
+	kwiDownTo
+	kwiStep
+	kwiRepeat
+	kwiUntil
 )
 
 var (
 	keywordList = []TKeyword{
 		TKeyword{kwiFunction, "функция"},
-		TKeyword{kwiFunction, "процедура"},
 		TKeyword{kwiFunction, "function"},
 		TKeyword{kwiFunction, "func"},
 		TKeyword{kwiFunction, "def"},
+		TKeyword{kwiProcedure, "процедура"},
+		TKeyword{kwiProcedure, "procedure"},
 		TKeyword{kwiVariable, "переменные"},
 		TKeyword{kwiVariable, "var"},
 		TKeyword{kwiBegin, "начало"},
@@ -114,19 +176,62 @@ var (
 		TKeyword{kwiWhile, "while"},
 		TKeyword{kwiNOT, "не"},
 		TKeyword{kwiNOT, "not"},
+		TKeyword{kwiAND, "и"},
+		TKeyword{kwiAND, "and"},
+		TKeyword{kwiOR, "или"},
+		TKeyword{kwiOR, "or"},
+		TKeyword{kwiXOR, "искл"},
+		TKeyword{kwiXOR, "xor"},
+		TKeyword{kwiShl, "сдвл"},
+		TKeyword{kwiShl, "shl"},
+		TKeyword{kwiShr, "сдвп"},
+		TKeyword{kwiShr, "shr"},
+		TKeyword{kwiReturn, "вернуть"},
+		TKeyword{kwiReturn, "return"},
+		TKeyword{kwiFor, "для"},
+		TKeyword{kwiFor, "for"},
+		TKeyword{kwiFrom, "от"},
+		TKeyword{kwiFrom, "from"},
+		TKeyword{kwiTo, "до"},
+		TKeyword{kwiTo, "to"},
+		TKeyword{kwiDown, "вниз"},
+		TKeyword{kwiDown, "down"},
+		TKeyword{kwiDownTo, "downto"},
+		TKeyword{kwiStep, "шаг"},
+		TKeyword{kwiStep, "step"},
+		TKeyword{kwiRepeat, "повторять"},
+		TKeyword{kwiRepeat, "repeat"},
+		TKeyword{kwiRepeat, "do"},
+		TKeyword{kwiUntil, "until"},
 		TKeyword{kwiUnknown, ""},
 	}
 )
 
 // ошибки синтаксиса
 var (
-	EExpectedExpression = &lsaError{Msg: "Отсутствует выражение после знака ="}
-	ESyntaxError        = &lsaError{Msg: "Синтаксическая ошибка"}
-	EExpectedArgument   = &lsaError{Msg: "Ожидается операнд"}
-	ETooMuchCloseRB     = &lsaError{Msg: "Слишком много )"}
-	ETooMuchOpenRB      = &lsaError{Msg: "Слишком много ("}
-	EExpectedCloseOper  = &lsaError{Msg: "Отсутствует 'конец'"}
-	EUnExpectedKeyword  = &lsaError{Msg: "Встретилось зарезервированное слово"}
+	EExpectedExpression    = newError("E201")
+	ESyntaxError           = newError("E202")
+	EExpectedArgument      = newError("E203")
+	ETooMuchCloseRB        = newError("E204")
+	ETooMuchOpenRB         = newError("E205")
+	EExpectedCloseOper     = newError("E206")
+	EUnExpectedKeyword     = newError("E207")
+	EExpectedType          = newError("E208")
+	EExpectedParamName     = newError("E209")
+	EExpectedParamType     = newError("E210")
+	EExpectedCloseRB       = newError("E211")
+	EExpectedVarName       = newError("E212")
+	EExpectedIdent         = newError("E213")
+	EExpectedVarType       = newError("E214")
+	EReturnOutsideFunction = newError("E215")
+	EProcedureReturnsValue = newError("E216")
+	EProcedureResult       = newError("E217")
+	EMissingReturn         = newError("E218")
+	EExpectedFrom          = newError("E219")
+	EExpectedTo            = newError("E220")
+	ENonPositiveStep       = newError("E221")
+	EExpectedUntil         = newError("E222")
+	EWhileNeedsBlock       = newError("E223")
 )
 
 func (self *TSyntaxDescriptor) Init() {
@@ -135,35 +240,97 @@ func (self *TSyntaxDescriptor) Init() {
 	self.LanguageItems = make([]TLanguageItem, 0, 0)
 	self.StrIdents = make([]string, 0, 0)
 	self.StrNumbers = make([]string, 0, 0)
+	self.Numbers = make([]TNumberValue, 0, 0)
 	self.StrStrings = make([]string, 0, 0)
 }
 
-func (self *TSyntaxDescriptor) AppendItem(AType TLanguageItemType) {
-	item := TLanguageItem{Type: AType}
+// Участок текста текущей лексемы, элементы получают его по умолчанию
+func (self *TSyntaxDescriptor) lexemSpan() TSpan {
+	if self.Lexem == nil {
+		return TSpan{Start: self.LastEnd, End: self.LastEnd}
+	}
+	return self.Lexem.Span
+}
+
+// Участок от APos до конца последней пройденной лексемы
+func (self *TSyntaxDescriptor) spanFrom(APos TPosition) TSpan {
+	return TSpan{Start: APos, End: self.LastEnd}
+}
+
+func (self *TSyntaxDescriptor) appendItemAt(AType TLanguageItemType,
+	AIndex uint, ASpan TSpan) {
+	item := TLanguageItem{Type: AType, Index: AIndex, Span: ASpan}
 	self.LanguageItems = append(self.LanguageItems, item)
 }
 
+func (self *TSyntaxDescriptor) AppendItem(AType TLanguageItemType) {
+	self.appendItemAt(AType, 0, self.lexemSpan())
+}
+
 func (self *TSyntaxDescriptor) AppendIdent(AName string) {
 	index := self.StrIdents.addUnique(AName)
-	item := TLanguageItem{Type: ltitIdent, Index: index}
-	self.LanguageItems = append(self.LanguageItems, item)
+	self.appendItemAt(ltitIdent, index, self.lexemSpan())
 }
 
-func (self *TSyntaxDescriptor) AppendNumber(S string) {
-	index := self.StrNumbers.addUnique(S)
-	item := TLanguageItem{Type: ltitNumber, Index: index}
-	self.LanguageItems = append(self.LanguageItems, item)
+func (self *TSyntaxDescriptor) AppendNumber(ANumber TNumberValue) {
+	index := self.StrNumbers.addUnique(ANumber.String())
+	if index == uint(len(self.Numbers)) {
+		self.Numbers = append(self.Numbers, ANumber)
+	}
+	self.appendItemAt(ltitNumber, index, self.lexemSpan())
 }
 
 func (self *TSyntaxDescriptor) AppendString(S string) {
 	index := self.StrStrings.addUnique(S)
-	item := TLanguageItem{Type: ltitString, Index: index}
-	self.LanguageItems = append(self.LanguageItems, item)
+	self.appendItemAt(ltitString, index, self.lexemSpan())
+}
+
+// Символ хранится в списке строк, но имеет тип ltitChar
+func (self *TSyntaxDescriptor) AppendChar(S string) {
+	index := self.StrStrings.addUnique(S)
+	self.appendItemAt(ltitChar, index, self.lexemSpan())
+}
+
+// Записывает элемент идентификатора с участком ASpan и возвращает его узел
+func (self *TSyntaxDescriptor) appendIdentAt(ASpan TSpan,
+	AName string) *TIdent {
+	index := self.StrIdents.addUnique(AName)
+	self.appendItemAt(ltitIdent, index, ASpan)
+	return &TIdent{TNodeBase: TNodeBase{Pos: ASpan.Start, End: ASpan.End},
+		Name: AName}
+}
+
+/*
+ Возвращает лексему, следующую за AL. Если перевод идёт из TReader, то
+ лексема читается при первом обращении к ней. Ошибка чтения запоминается
+ в ReadError, а вместо лексемы возвращается ltEOF, чтобы перевод закончился.
+*/
+func (self *TSyntaxDescriptor) nextOf(AL *TLexem) *TLexem {
+	if AL.Next == nil && AL.Type != ltEOF && self.Reader != nil {
+		L, E := self.Reader.NextLexem()
+		if E != nil {
+			self.ReadError = E
+			end := AL.Span.End
+			L = &TLexem{Type: ltEOF, LineNo: end.LineNo, ColumnNo: end.ColumnNo,
+				Span: TSpan{Start: end, End: end}}
+		}
+		AL.Next = L
+	}
+	return AL.Next
 }
 
 func (self *TSyntaxDescriptor) NextLexem() {
 	if self.Lexem != nil && self.Lexem.Type != ltEOF {
-		self.Lexem = self.Lexem.Next
+		if self.Lexem.Type != ltEOL {
+			self.LastEnd = self.Lexem.Span.End
+		}
+		self.Lexem = self.nextOf(self.Lexem)
+	}
+}
+
+func (self *TSyntaxDescriptor) skipEOL() {
+	if self.Lexem.Type == ltEOL {
+		self.NextLexem()
 	}
 }
 
@@ -179,16 +346,15 @@ func (self *TSyntaxDescriptor) ExtractComplexIdent() (error, string,
 		return self.Lexem.errorAt(ESyntaxError), "", kwiUnknown
 	}
 	S := self.Lexem.LexemAsString()
-	kId := toKeywordId(S)
+	kId := self.identKeyword(S, true)
 	if kId != kwiUnknown {
 		return nil, "", kId
 	}
-	kId = kwiUnknown
 	self.NextLexem()
 	res := S
 	for self.Lexem.Type == ltIdent {
 		S := self.Lexem.LexemAsString()
-		kId := toKeywordId(S)
+		kId := self.identKeyword(S, false)
 		if kId != kwiUnknown {
 			return nil, res, kId
 		}
@@ -198,15 +364,129 @@ func (self *TSyntaxDescriptor) ExtractComplexIdent() (error, string,
 	return nil, res, kwiUnknown
 }
 
-func toKeywordId(S string) TKeywordId {
-	for i := 0; i < len(keywordList); i++ {
-		if S == keywordList[i].Name {
-			return keywordList[i].Id
+/*
+ Возвращает номер зарезервированного слова из набора Keywords. При переводе
+ из TReader набор может быть задан прагмой, которая читается вместе
+ с лексемами.
+*/
+func (self *TSyntaxDescriptor) keywordId(S string) TKeywordId {
+	K := self.Keywords
+	if K == nil && self.Reader != nil {
+		K = self.Reader.Keywords
+	}
+	if K == nil {
+		K = standardKeywords
+	}
+	return K.Id(S)
+}
+
+// Возвращает истину для слов, которые зарезервированы только в части
+// оператора, например 'до' в заголовке цикла 'для', или только после
+// операнда, как операции словами; 'повторять' зарезервировано только в
+// начале оператора
+func isContextKeyword(AId TKeywordId) bool {
+	switch AId {
+	case kwiFrom, kwiTo, kwiDown, kwiDownTo, kwiStep, kwiRepeat, kwiUntil:
+		return true
+	}
+	return isWordOperation(AId)
+}
+
+// Возвращает истину для операций, записанных словом: и, или, искл, сдвл,
+// сдвп и их английских названий
+func isWordOperation(AId TKeywordId) bool {
+	switch AId {
+	case kwiAND, kwiOR, kwiXOR, kwiShl, kwiShr:
+		return true
+	}
+	return false
+}
+
+/*
+ Возвращает номер зарезервированного слова S, которое заканчивает
+ идентификатор, или kwiUnknown, если S входит в идентификатор. Слова
+ isContextKeyword зарезервированы только в той части оператора, где они
+ нужны, в остальном тексте они входят в идентификаторы:
+ "Расстояние до цели = 5". Операция словом стоит после операнда, поэтому
+ она заканчивает идентификатор, но первым словом (AFirst) идентификатора
+ может быть: "и = 5".
+*/
+func (self *TSyntaxDescriptor) identKeyword(S string, AFirst bool) TKeywordId {
+	kId := self.keywordId(S)
+	if !isContextKeyword(kId) {
+		return kId
+	}
+	if isWordOperation(kId) {
+		if AFirst {
+			return kwiUnknown
+		}
+		return kId
+	}
+	for _, W := range self.contextWords {
+		if W == kId {
+			return kId
 		}
 	}
 	return kwiUnknown
 }
 
+/*
+ Делает слова AWords зарезервированными в части оператора, которая
+ переводится до вызова возвращённой функции; она восстанавливает прежние
+ слова. Без слов AWords все слова isContextKeyword входят в идентификаторы.
+*/
+func (self *TSyntaxDescriptor) reserve(AWords ...TKeywordId) (restore func()) {
+	outer := self.contextWords
+	self.contextWords = AWords
+	return func() { self.contextWords = outer }
+}
+
+// Запоминает, что текущая лексема переведена как слово AId, см. contextUses
+func (self *TSyntaxDescriptor) useKeyword(AId TKeywordId) {
+	if self.contextUses != nil {
+		self.contextUses[self.Lexem.Span.Start.Offset] = AId
+	}
+}
+
+/*
+Переводит тип данных, AError — ошибка, если тип отсутствует
+ТИП = [<ИМЯ ПАКЕТА> '.']<ИДЕНТИФИКАТОР>
+*/
+func (self *TSyntaxDescriptor) translateDataType(AError *lsaError) (*TTypeRef,
+	error) {
+	var (
+		name string
+		E    error
+	)
+
+	pos := self.Lexem.Position()
+	T := &TTypeRef{TNodeBase: TNodeBase{Pos: pos}}
+
+	E, name, _ = self.ExtractComplexIdent()
+	if E != nil || name == "" {
+		//TODO: Тип может быть 'array ...'
+		return nil, self.Lexem.errorAt(AError)
+	}
+	span := self.spanFrom(pos)
+	self.appendItemAt(ltitDataType, 0, span)
+	if self.Lexem.Type == ltDot {
+		self.NextLexem()
+		self.appendItemAt(ltitPackageName, 0, span)
+		T.Package = self.appendIdentAt(span, name)
+
+		pos = self.Lexem.Position()
+		E, name, _ = self.ExtractComplexIdent()
+		if E != nil || name == "" {
+			return nil, self.Lexem.errorAt(AError)
+		}
+		span = self.spanFrom(pos)
+	}
+	T.Name = self.appendIdentAt(span, name)
+	T.End = self.LastEnd
+
+	return T, nil
+}
+
 /*
 BNF-правила для прототипа функции
 ПРОТОТИП ФУНКЦИИ = [<ПАРАМЕТРЫ>] [<РЕЗУЛЬТАТ>]
@@ -215,12 +495,9 @@ BNF-правила для прототипа функции
 СПИСОК ИМЁН = <ИМЯ> {',' <ИМЯ>}
 РЕЗУЛЬТАТ = ':' [<ИМЯ ПАКЕТА> '.']<ИДЕНТИФИКАТОР>
 */
-func (self *TSyntaxDescriptor) translateFunctionPrototype() error {
-	var (
-		name string
-		E    error
-		kId  TKeywordId = kwiUnknown
-	)
+func (self *TSyntaxDescriptor) translateFunctionPrototype() (
+	Params []*TVarSpec, Result *TTypeRef, E error) {
+	var ident *TIdent
 
 	//[<ПАРАМЕТРЫ>]
 	if self.Lexem.Type == ltOpenParenthesis {
@@ -232,13 +509,15 @@ func (self *TSyntaxDescriptor) translateFunctionPrototype() error {
 
 		//<ТИПИЗИРОВАННЫЕ ПАРАМЕТРЫ> {',' <ТИПИЗИРОВАННЫЕ ПАРАМЕТРЫ>} ')'
 		for self.Lexem.Type != ltCloseParenthesis {
+			spec := &TVarSpec{TNodeBase: TNodeBase{Pos: self.Lexem.Position()}}
+
 			//СПИСОК ИМЁН = <ИМЯ> {',' <ИМЯ>}
 			for {
-				E = self.translateComplexIdent()
+				ident, E = self.translateComplexIdent()
 				if E != nil {
-					return self.Lexem.errorAt(&lsaError{
-						Msg: E.Error() + ". Отсутствует имя параметра"})
+					return nil, nil, self.Lexem.errorAt(EExpectedParamName)
 				}
+				spec.Names = append(spec.Names, ident)
 				if self.Lexem.Type != ltComma {
 					break
 				}
@@ -246,30 +525,16 @@ func (self *TSyntaxDescriptor) translateFunctionPrototype() error {
 			}
 
 			if self.Lexem.Type != ltColon {
-				return self.Lexem.errorAt(&lsaError{
-					Msg: "Не указан тип параметра"})
+				return nil, nil, self.Lexem.errorAt(EExpectedParamType)
 			}
 			self.NextLexem()
 
-			//ТИП = [<ИМЯ ПАКЕТА> '.']<ИДЕНТИФИКАТОР>
-			E, name, kId = self.ExtractComplexIdent()
-			if E != nil || kId != kwiUnknown {
-				//TODO: Тип может быть 'array ...'
-				return self.Lexem.errorAt(&lsaError{
-					Msg: ". Ожидается тип"})
-			}
-			self.AppendItem(ltitDataType)
-			if self.Lexem.Type == ltDot {
-				self.NextLexem()
-				self.AppendItem(ltitPackageName)
-				self.AppendIdent(name)
-				E, name, kId = self.ExtractComplexIdent()
-				if E != nil || kId != kwiUnknown {
-					return self.Lexem.errorAt(&lsaError{
-						Msg: ". Ожидается тип"})
-				}
+			if spec.Type, E = self.translateDataType(EExpectedType); E != nil {
+				return nil, nil, E
 			}
-			self.AppendIdent(name)
+			spec.End = self.LastEnd
+			Params = append(Params, spec)
+
 			if self.Lexem.Type != ltComma {
 				break
 			}
@@ -277,7 +542,7 @@ func (self *TSyntaxDescriptor) translateFunctionPrototype() error {
 		}
 
 		if self.Lexem.Type != ltCloseParenthesis {
-			return self.Lexem.errorAt(&lsaError{Msg: "Ожидается ')'"})
+			return nil, nil, self.Lexem.errorAt(EExpectedCloseRB)
 		}
 		self.NextLexem()
 	}
@@ -286,30 +551,17 @@ func (self *TSyntaxDescriptor) translateFunctionPrototype() error {
 	//РЕЗУЛЬТАТ = ':' [<ИМЯ ПАКЕТА> '.']<ИМЯ ТИПА>
 	if self.Lexem.Type == ltColon {
 		self.NextLexem()
-		E, name, kId = self.ExtractComplexIdent()
-		if E != nil {
-			return self.Lexem.errorAt(&lsaError{
-				Msg: ". Ожидается тип"})
+		if Result, E = self.translateDataType(EExpectedType); E != nil {
+			return nil, nil, E
 		}
-		self.AppendItem(ltitDataType)
-		if self.Lexem.Type == ltDot {
-			self.NextLexem()
-			self.AppendItem(ltitPackageName)
-			self.AppendIdent(name)
-			E, name, kId = self.ExtractComplexIdent()
-			if E != nil || kId != kwiUnknown {
-				if E != nil {
-					return self.Lexem.errorAt(&lsaError{Msg: "Ожидается тип"})
-				}
-			}
-		}
-		self.AppendIdent(name)
 	}
 
-	return nil
+	return Params, Result, nil
 }
 
-func (self *TSyntaxDescriptor) translateVarList() error {
+// Переводит список переменных, если текущая лексема 'переменные' или 'var',
+// иначе возвращает nil
+func (self *TSyntaxDescriptor) translateVarList() (*TVarDecl, error) {
 	var (
 		S, name string
 		E       error
@@ -317,58 +569,48 @@ func (self *TSyntaxDescriptor) translateVarList() error {
 	)
 
 	S = self.Lexem.LexemAsString()
-	keywId = toKeywordId(S)
-	if keywId == kwiVariable {
-		self.AppendItem(ltitVarList)
-		self.NextLexem()
+	keywId = self.keywordId(S)
+	if keywId != kwiVariable {
+		return nil, nil
+	}
 
-		typeNotPresent := true
-		for {
-			E, name, keywId = self.ExtractComplexIdent()
-			if E != nil || keywId != kwiUnknown {
-				if E != nil {
-					return self.Lexem.errorAt(&lsaError{Msg: "Ожидается имя переменной"})
-				}
-			}
-			self.AppendIdent(name)
+	V := &TVarDecl{TNodeBase: TNodeBase{Pos: self.Lexem.Position()}}
+	self.AppendItem(ltitVarList)
+	self.NextLexem()
 
-			if self.Lexem.Type == ltColon {
-				self.NextLexem()
-				E, name, keywId = self.ExtractComplexIdent()
-				if E != nil || keywId != kwiUnknown {
-					if E != nil {
-						return self.Lexem.errorAt(&lsaError{Msg: "Ожидается тип переменной"})
-					}
-				}
-				self.AppendItem(ltitDataType)
-				if self.Lexem.Type == ltDot {
-					self.NextLexem()
-					self.AppendItem(ltitPackageName)
-					self.AppendIdent(name)
-					E, name, keywId = self.ExtractComplexIdent()
-					if E != nil || keywId != kwiUnknown {
-						if E != nil {
-							return self.Lexem.errorAt(&lsaError{Msg: "Ожидается тип переменной"})
-						}
-					}
-					typeNotPresent = false
-				}
-				self.AppendIdent(name)
-				typeNotPresent = false
-			}
-			//если после параметра нет ',', значит список кончился, жду 'начало'
-			if self.Lexem.Type != ltComma {
-				break
-			}
+	// имена переменных, для которых ещё не встретился тип
+	names := make([]*TIdent, 0, 4)
+	for {
+		pos := self.Lexem.Position()
+		E, name, _ = self.ExtractComplexIdent()
+		if E != nil || name == "" {
+			return nil, self.Lexem.errorAt(EExpectedVarName)
+		}
+		names = append(names, self.appendIdentAt(self.spanFrom(pos), name))
+
+		if self.Lexem.Type == ltColon {
 			self.NextLexem()
-			typeNotPresent = false
+			spec := &TVarSpec{TNodeBase: names[0].TNodeBase, Names: names}
+			spec.Type, E = self.translateDataType(EExpectedVarType)
+			if E != nil {
+				return nil, E
+			}
+			spec.End = self.LastEnd
+			V.Specs = append(V.Specs, spec)
+			names = make([]*TIdent, 0, 4)
 		}
-		if typeNotPresent {
-			return self.Lexem.errorAt(&lsaError{Msg: "Не указан тип параметра"})
+		//если после параметра нет ',', значит список кончился, жду 'начало'
+		if self.Lexem.Type != ltComma {
+			break
 		}
+		self.NextLexem()
+	}
+	if len(names) > 0 {
+		return nil, self.Lexem.errorAt(EExpectedParamType)
 	}
+	V.End = self.LastEnd
 
-	return nil
+	return V, nil
 }
 
 /*
@@ -386,8 +628,11 @@ BNF-правила для объявления функции
 СПИСОК ПЕРЕМЕННЫХ = <ПЕРЕМЕННАЯ> {(';' | <LF>) <ПЕРЕМЕННАЯ>}
 ПЕРЕМЕННАЯ = <ИМЯ ПЕРЕМЕННОЙ> ':' <ТИП>
 ИМЯ ПЕРЕМЕННОЙ = <ИДЕНТИФИКАТОР>
+Если функция с результатом возвращает значение не на всех путях, то
+записывается ошибка EMissingReturn, а перевод продолжается.
 */
-func (self *TSyntaxDescriptor) translateFunctionDeclaration() error {
+func (self *TSyntaxDescriptor) translateFunctionDeclaration() (*TFuncDecl,
+	error) {
 	var (
 		S, name string
 		E       error
@@ -395,63 +640,80 @@ func (self *TSyntaxDescriptor) translateFunctionDeclaration() error {
 	)
 
 	S = self.Lexem.LexemAsString()
-	keywId = toKeywordId(S)
-	if keywId != kwiFunction {
-		return self.Lexem.errorAt(&lsaError{Msg: "Can't translateFunctionDeclaration, type not function."})
+	keywId = self.keywordId(S)
+	if keywId != kwiFunction && keywId != kwiProcedure {
+		return nil, self.Lexem.errorAt(ESyntaxError)
 	}
 
+	F := &TFuncDecl{TNodeBase: TNodeBase{Pos: self.Lexem.Position()},
+		Procedure: keywId == kwiProcedure}
 	self.AppendItem(ltitFunction)
 	self.NextLexem()
 
 	// [<ИМЯ КЛАССА> '.']<ИДЕНТИФИКАТОР> '('
+	pos := self.Lexem.Position()
 	E, name, keywId = self.ExtractComplexIdent()
 	if E != nil || keywId != kwiUnknown {
 		if E != nil {
-			return self.Lexem.errorAt(&lsaError{Msg: "Ожидается идентификатор"})
+			return nil, self.Lexem.errorAt(EExpectedIdent)
 		}
 	}
 
+	span := self.spanFrom(pos)
 	if self.Lexem.Type == ltDot { //функция является членом класса
 		self.NextLexem()
-		self.AppendItem(ltitClassMember)
-		self.AppendIdent(name)
+		self.appendItemAt(ltitClassMember, 0, span)
+		F.Class = self.appendIdentAt(span, name)
+
+		pos = self.Lexem.Position()
 		E, name, keywId = self.ExtractComplexIdent()
 		if E != nil || keywId != kwiUnknown {
-			return self.Lexem.errorAt(&lsaError{Msg: "Ожидается идентификатор"})
+			return nil, self.Lexem.errorAt(EExpectedIdent)
 		}
+		span = self.spanFrom(pos)
 	}
-	self.AppendIdent(name)
+	F.Name = self.appendIdentAt(span, name)
 
-	if E = self.translateFunctionPrototype(); E != nil {
-		return E
+	if F.Params, F.Result, E = self.translateFunctionPrototype(); E != nil {
+		return nil, E
+	}
+	if F.Procedure && F.Result != nil {
+		self.recordError(F.Result.Pos.errorAt(EProcedureResult))
 	}
 
 	if self.Lexem.Type == ltSemicolon {
 		self.NextLexem()
 	}
+	self.skipEOL()
 
 	// читаю список локальных переменных
-	if E := self.translateVarList(); E != nil {
-		return E
-	}
-	if E := self.translateGroupOfStatements(); E != nil {
-		return E
+	if F.Vars, E = self.translateVarList(); E != nil {
+		return nil, E
 	}
+	outer := self.function
+	self.function = F
+	defer func() { self.function = outer }()
 
-	return nil
-}
-
-func (self *TLexem) skipEOL() PLexem {
-	if self.Type == ltEOL {
-		return self.Next
+	if F.Body, E = self.translateGroupOfStatements(); E != nil {
+		return nil, E
 	}
-	return self
+	F.End = self.LastEnd
+	if F.Result != nil && !F.Procedure {
+		if E = checkReturns(F); E != nil {
+			self.recordError(E)
+		}
+	}
+
+	return F, nil
 }
 
 func (L *TLexem) errorAt(E *lsaError) error {
-	E.LineNo = L.LineNo
-	E.ColumnNo = L.ColumnNo
-	return E
+	C := L.Position().newError(E)
+	// конец лексемы неизвестен, пока анализатор её не дочитал
+	if L.Span.End.Offset > L.Span.Start.Offset {
+		C.Span.End = L.Span.End
+	}
+	return C
 }
 
 func (list *TStringArray) addUnique(S string) uint {
@@ -465,30 +727,30 @@ func (list *TStringArray) addUnique(S string) uint {
 }
 
 func (self *TSyntaxDescriptor) translateNumber() error {
-	S := self.Lexem.LexemAsString()
-	self.AppendNumber(S)
+	self.AppendNumber(self.Lexem.Number)
 	self.NextLexem()
 	return nil
 }
 
-func (self *TSyntaxDescriptor) translateComplexIdent() error {
+func (self *TSyntaxDescriptor) translateComplexIdent() (*TIdent, error) {
 	self.Keyword = kwiUnknown
 	if self.Lexem.Type != ltIdent {
-		return self.Lexem.errorAt(&lsaError{Msg: "Can't translateComplexIdent, type not ltIdent."})
+		return nil, self.Lexem.errorAt(EExpectedIdent)
 	}
 
 	S := self.Lexem.LexemAsString()
-	K := toKeywordId(S)
+	K := self.identKeyword(S, true)
 	if K != kwiUnknown {
 		self.Keyword = K
-		return self.Lexem.errorAt(&lsaError{Msg: "Can't translateComplexIdent, keyword."})
+		return nil, self.Lexem.errorAt(EUnExpectedKeyword)
 	}
+	pos := self.Lexem.Position()
 	self.NextLexem()
 
 	ident := S
 	for self.Lexem.Type == ltIdent {
 		S = self.Lexem.LexemAsString()
-		K = toKeywordId(S)
+		K = self.identKeyword(S, false)
 		if K != kwiUnknown {
 			self.Keyword = K
 			break
@@ -498,20 +760,17 @@ func (self *TSyntaxDescriptor) translateComplexIdent() error {
 		self.NextLexem()
 	}
 
-	self.AppendIdent(ident)
-	return nil
+	return self.appendIdentAt(self.spanFrom(pos), ident), nil
 }
 
 func (self *TSyntaxDescriptor) translateString() error {
 	if self.Lexem.Type != ltString {
-		return self.Lexem.errorAt(&lsaError{
-			Msg: "Can't translateString, type not ltString."})
+		return self.Lexem.errorAt(ESyntaxError)
 	}
 
-	S := self.Lexem.LexemAsString()
-	self.NextLexem()
-
+	S := self.Lexem.Value
 	self.AppendString(S)
+	self.NextLexem()
 
 	return nil
 }
@@ -519,18 +778,23 @@ func (self *TSyntaxDescriptor) translateString() error {
 // Анализирует унарные операции:
 // ! not не - логическое нет
 // & @ - адрес
-func (self *TSyntaxDescriptor) translateUnaryOperation() error {
+// - + - знак числа
+// ~ - поразрядное отрицание
+// Если текущая лексема — унарная операция, то пропускает её и возвращает
+// тип операции
+func (self *TSyntaxDescriptor) translateUnaryOperation() (TLanguageItemType,
+	error) {
 	var curT TLexemType = self.Lexem.Type
 	var lit TLanguageItemType = ltitUnknown
 
 	switch curT {
 	case ltIdent:
 		S := self.Lexem.LexemAsString()
-		K := toKeywordId(S)
+		K := self.keywordId(S)
 		if K == kwiNOT {
 			lit = ltitNOT
 		} else {
-			return self.Lexem.errorAt(ESyntaxError)
+			return ltitUnknown, self.Lexem.errorAt(ESyntaxError)
 		}
 
 	case ltExclamationMark:
@@ -539,225 +803,598 @@ func (self *TSyntaxDescriptor) translateUnaryOperation() error {
 	case ltAmpersand, ltAt:
 		lit = ltitAddressOf
 
+	case ltMinus:
+		lit = ltitNegate
+
+	case ltPlus:
+		lit = ltitUnaryPlus
+
+	case ltTilde:
+		lit = ltitBitNOT
+
 	default:
-		return self.Lexem.errorAt(ESyntaxError)
+		return ltitUnknown, self.Lexem.errorAt(ESyntaxError)
 	}
 
 	self.AppendItem(lit)
 	self.NextLexem()
-	return nil
+	return lit, nil
+}
+
+func (self *TSyntaxDescriptor) pushOperand(X TExpr) {
+	self.Operands = append(self.Operands, X)
+}
+
+func (self *TSyntaxDescriptor) popOperand() TExpr {
+	n := len(self.Operands) - 1
+	X := self.Operands[n]
+	self.Operands = self.Operands[:n]
+	return X
+}
+
+// Возвращает лексему, идущую после сложного идентификатора, который
+// начинается с текущей лексемы, не сдвигая текущую лексему
+func (self *TSyntaxDescriptor) lexemAfterComplexIdent() *TLexem {
+	var L *TLexem = self.Lexem
+	for L.Type == ltIdent &&
+		self.identKeyword(L.LexemAsString(), L == self.Lexem) == kwiUnknown {
+		L = self.nextOf(L)
+	}
+	return L
+}
+
+// Возвращает истину, если с текущей лексемы начинается вызов функции
+func (self *TSyntaxDescriptor) isCall() bool {
+	if self.Lexem.Type != ltIdent {
+		return false
+	}
+	L := self.lexemAfterComplexIdent()
+	return L != self.Lexem &&
+		(L.Type == ltOpenParenthesis || L.Type == ltDot)
+}
+
+/*
+BNF-определения для вызова функции
+ВЫЗОВ ФУНКЦИИ = [<ОБЪЕКТ> '.']<СЛОЖНЫЙ ИДЕНТИФИКАТОР> '(' [<ПАРАМЕТРЫ>] ')'
+ОБЪЕКТ = <СЛОЖНЫЙ ИДЕНТИФИКАТОР>
+ПАРАМЕТРЫ = <ВЫРАЖЕНИЕ> {',' <ВЫРАЖЕНИЕ>}
+Элементы языка: ltitCall [ltitClassMember <ОБЪЕКТ>] <ИМЯ> ltitOpenParenthesis
+  [<ВЫРАЖЕНИЕ> {ltitComma <ВЫРАЖЕНИЕ>}] ltitCloseParenthesis
+*/
+func (self *TSyntaxDescriptor) translateCall() (C *TCallExpr, E error) {
+	C = &TCallExpr{TNodeBase: TNodeBase{Pos: self.Lexem.Position()}}
+	self.AppendItem(ltitCall)
+
+	if self.lexemAfterComplexIdent().Type == ltDot {
+		self.AppendItem(ltitClassMember)
+		if C.Object, E = self.translateComplexIdent(); E != nil {
+			return nil, E
+		}
+		self.NextLexem() // пропускаю '.'
+	}
+	if C.Func, E = self.translateComplexIdent(); E != nil {
+		return nil, E
+	}
+
+	if self.Lexem.Type != ltOpenParenthesis {
+		return nil, self.Lexem.errorAt(ESyntaxError)
+	}
+	self.AppendItem(ltitOpenParenthesis)
+	self.NextLexem()
+	self.Parenthesis++
+
+	self.skipEOL()
+	if self.Lexem.Type != ltCloseParenthesis {
+		for {
+			if E = self.translateBinaryExpression(1); E != nil {
+				return nil, E
+			}
+			C.Args = append(C.Args, self.popOperand())
+
+			self.skipEOL()
+			if self.Lexem.Type != ltComma {
+				break
+			}
+			self.AppendItem(ltitComma)
+			self.NextLexem()
+			self.skipEOL()
+		}
+	}
+
+	if self.Lexem.Type != ltCloseParenthesis {
+		return nil, self.Lexem.errorAt(ETooMuchOpenRB)
+	}
+	self.AppendItem(ltitCloseParenthesis)
+	self.NextLexem()
+	self.Parenthesis--
+	C.End = self.LastEnd
+
+	return C, nil
+}
+
+// Переводит вызов функции, записанный отдельным оператором
+func (self *TSyntaxDescriptor) translateCallStatement() (*TCallStmt, error) {
+	pos := self.Lexem.Position()
+	C, E := self.translateCall()
+	if E != nil {
+		return nil, E
+	}
+	return &TCallStmt{TNodeBase{Pos: pos, End: C.End}, C}, nil
 }
 
 //TODO: распознание символа как аргумента
-//TODO: распознание вызова функции как аргумента
 /*
-АРГУМЕНТ = {'('} <ПРОСТОЙ АРГУМЕНТ> {')'}
+Переводит аргумент и кладёт его дерево в стек операндов
+АРГУМЕНТ = <УНАРНАЯ ОПЕРАЦИЯ> <АРГУМЕНТ> | '(' <ВЫРАЖЕНИЕ> ')'
+  | <ПРОСТОЙ АРГУМЕНТ>
 ПРОСТОЙ АРГУМЕНТ = <ЧИСЛО> | <СЛОЖНЫЙ ИДЕНТИФИКАТОР> | <ВЫЗОВ ФУНКЦИИ>
   | <СИМВОЛ> | <СТРОКА>
-ВЫЗОВ ФУНКЦИИ = <СЛОЖНЫЙ ИДЕНТИФИКАТОР> '(' [<ПАРАМЕТРЫ>] ')'
-ПАРАМЕТРЫ = [<ВЫРАЖЕНИЕ>] {',' [<ВЫРАЖЕНИЕ>]}
+Унарная операция выполняется раньше бинарных, кроме возведения в степень:
+"не А ^ 2" означает "не (А ^ 2)", "-2 ^ 2" равно -4.
+Знак перед числом входит в константу: "-5" — константа, а не операция.
 */
 func (Self *TSyntaxDescriptor) translateArgument() (E error) {
 	var (
-		S        string
-		wasUnary bool = false
+		S string
+		X TExpr
 	)
 
-	E = Self.translateUnaryOperation()
-	if E == nil {
-		wasUnary = true
+	pos := Self.Lexem.Position()
+	if lit, E := Self.translateUnaryOperation(); E == nil {
+		E = Self.translateBinaryExpression(operationPriority(ltitInvolution))
+		if E != nil {
+			return E
+		}
+		X := Self.popOperand()
+		base := TNodeBase{Pos: pos, End: X.Span().End}
+		if N := foldSign(lit, X); N != nil {
+			N.TNodeBase = base
+			Self.pushOperand(N)
+		} else {
+			Self.pushOperand(&TUnaryExpr{base, lit, X})
+		}
+		return nil
 	}
 
-	E = nil
-
-	// пропускаю необязательные открывающие скобки
-	for Self.Lexem.Type == ltOpenParenthesis {
-		Self.NextLexem()
+	switch Self.Lexem.Type {
+	case ltOpenParenthesis:
 		Self.AppendItem(ltitOpenParenthesis)
+		Self.NextLexem()
 		Self.Parenthesis++
-	}
 
-	if !wasUnary {
-		Self.translateUnaryOperation()
-	}
+		if E = Self.translateBinaryExpression(1); E != nil {
+			return
+		}
 
-	switch Self.Lexem.Type {
-	case ltNumber:
-		S = Self.Lexem.LexemAsString()
-		Self.AppendNumber(S)
+		if Self.Lexem.Type != ltCloseParenthesis {
+			return Self.Lexem.errorAt(ETooMuchOpenRB)
+		}
+		Self.AppendItem(ltitCloseParenthesis)
 		Self.NextLexem()
+		Self.Parenthesis--
+		return nil
+
+	case ltNumber, ltFloat:
+		N := Self.Lexem.Number
+		S = N.String()
+		Self.AppendNumber(N)
+		Self.NextLexem()
+		X = &TLiteral{TNodeBase: TNodeBase{Pos: pos}, Kind: ltitNumber, Value: S,
+			Number: N}
 
 	case ltIdent:
-		E = Self.translateComplexIdent()
+		if Self.isCall() {
+			X, E = Self.translateCall()
+		} else {
+			X, E = Self.translateComplexIdent()
+		}
 
 	case ltString:
+		S = Self.Lexem.Value
 		E = Self.translateString()
+		X = &TLiteral{TNodeBase: TNodeBase{Pos: pos}, Kind: ltitString, Value: S}
+
+	case ltChar:
+		S = Self.Lexem.Value
+		Self.AppendChar(S)
+		Self.NextLexem()
+		X = &TLiteral{TNodeBase: TNodeBase{Pos: pos}, Kind: ltitChar, Value: S}
 
 	default:
 		return Self.Lexem.errorAt(EExpectedArgument)
 	}
-
-	// пропускаю необязательные закрывающие скобки
-	for Self.Lexem.Type == ltCloseParenthesis {
-		Self.NextLexem()
-		Self.AppendItem(ltitCloseParenthesis)
-		Self.Parenthesis--
+	if E != nil {
+		return
+	}
+	if lit, ok := X.(*TLiteral); ok {
+		lit.End = Self.LastEnd
 	}
-	return
+
+	Self.pushOperand(X)
+	return nil
 }
 
-//TODO: добавить проверку остальных операций: ! ~ & | and or xor not shr shl
-// Анализирует следующие операции:
-// *  +  -  /  =  >  >=  >>  <  <=  <<  <>
-func (self *TSyntaxDescriptor) translateOperation() error {
-	var curT, nextT TLexemType
-	var lit TLanguageItemType
+/*
+Возвращает числовую константу со знаком, если ASign — знак числа, а X —
+числовая константа, иначе nil
+*/
+func foldSign(ASign TLanguageItemType, X TExpr) *TLiteral {
+	L, ok := X.(*TLiteral)
+	if !ok || L.Kind != ltitNumber ||
+		(ASign != ltitNegate && ASign != ltitUnaryPlus) {
+		return nil
+	}
 
-	curT = self.Lexem.Type
-	nextT = ltUnknown
-	if self.Lexem.Next != nil {
-		nextT = self.Lexem.Next.Type
+	N := L.Number
+	if ASign == ltitNegate {
+		N = N.Neg()
 	}
+	return &TLiteral{Kind: ltitNumber, Value: N.String(), Number: N}
+}
 
-	switch curT {
+/*
+Приоритет бинарной операции, чем больше число, тем раньше выполняется
+операция. Для лексем, не являющихся операцией, возвращает 0
+  1: или or ||
+  2: искл xor
+  3: и and &&
+  4: = <> < > <= >=
+  5: << >> сдвл сдвп shl shr
+  6: + - | ~
+  7: * / % &
+  8: ^ ** (правоассоциативная)
+Логические операции (и, или, искл) отличаются от поразрядных (&, |, ~):
+"А < 1 или Б > 2" сравнивает, а затем объединяет результаты, а в
+"А + Б & 7" поразрядное И выполняется раньше сложения.
+*/
+func operationPriority(AOperation TLanguageItemType) int {
+	switch AOperation {
+	case ltitOR:
+		return 1
+	case ltitXOR:
+		return 2
+	case ltitAND:
+		return 3
+	case ltitEqual, ltitNotEqual, ltitAbove, ltitBelow, ltitAboveEqual,
+		ltitBelowEqual:
+		return 4
+	case ltitLeftShift, ltitRightShift:
+		return 5
+	case ltitMathAdd, ltitMathSub, ltitBitOR, ltitBitXOR:
+		return 6
+	case ltitMathMul, ltitMathDiv, ltitModulo, ltitBitAND:
+		return 7
+	case ltitInvolution:
+		return 8
+	}
+	return 0
+}
+
+// Возвращает истину, если операции с одинаковым приоритетом выполняются
+// справа налево: 2 ^ 3 ^ 2 = 2 ^ (3 ^ 2)
+func isRightAssociative(AOperation TLanguageItemType) bool {
+	return AOperation == ltitInvolution
+}
+
+/*
+Возвращает операцию, которую обозначает лексема, или ltitUnknown.
+Анализирует следующие операции:
+*  +  -  /  %  ^  **  =  ==  >  >=  >>  <  <=  <<  <>  !=  &  |  ~  &&  ||
+Знак & после операнда — поразрядное И, а перед операндом — взятие адреса,
+см. translateUnaryOperation
+*/
+func lexemOperation(AType TLexemType) TLanguageItemType {
+	switch AType {
 	case ltStar:
-		lit = ltitMathMul
+		return ltitMathMul
 	case ltPlus:
-		lit = ltitMathAdd
+		return ltitMathAdd
 	case ltMinus:
-		lit = ltitMathSub
+		return ltitMathSub
 	case ltSlash:
-		lit = ltitMathDiv
-	case ltEqualSign:
-		lit = ltitEqual
+		return ltitMathDiv
+	case ltPercent:
+		return ltitModulo
+	case ltPower, ltInvolution:
+		return ltitInvolution
+	case ltAmpersand:
+		return ltitBitAND
+	case ltVerticalLine:
+		return ltitBitOR
+	case ltTilde:
+		return ltitBitXOR
+	case ltLogicalAnd:
+		return ltitAND
+	case ltLogicalOr:
+		return ltitOR
+	case ltEqualSign, ltDoubleEqual:
+		return ltitEqual
 	case ltAboveSign:
-		lit = ltitAbove
-		if nextT == ltEqualSign {
-			self.NextLexem()
-			lit = ltitAboveEqual
-		} else if nextT == ltAboveSign {
-			self.NextLexem()
-			lit = ltitRightShift
+		return ltitAbove
+	case ltAboveOrEqual:
+		return ltitAboveEqual
+	case ltRightShift:
+		return ltitRightShift
+	case ltBelowSign:
+		return ltitBelow
+	case ltBelowOrEqual:
+		return ltitBelowEqual
+	case ltLeftShift:
+		return ltitLeftShift
+	case ltNotEqual, ltExclamationEqual:
+		return ltitNotEqual
+	}
+	return ltitUnknown
+}
+
+// Возвращает операцию, которую обозначает текущая лексема, в том числе
+// словами: и, или, искл, сдвл, сдвп, and, or, xor, shl, shr
+func (self *TSyntaxDescriptor) lexemOperation() TLanguageItemType {
+	if self.Lexem.Type != ltIdent {
+		return lexemOperation(self.Lexem.Type)
+	}
+	switch self.keywordId(self.Lexem.LexemAsString()) {
+	case kwiAND:
+		return ltitAND
+	case kwiOR:
+		return ltitOR
+	case kwiXOR:
+		return ltitXOR
+	case kwiShl:
+		return ltitLeftShift
+	case kwiShr:
+		return ltitRightShift
+	}
+	return ltitUnknown
+}
+
+/*
+Переводит выражение методом восхождения по приоритетам, выполняются только
+операции с приоритетом не меньше AMinPriority. Дерево выражения кладётся
+в стек операндов.
+ВЫРАЖЕНИЕ = <АРГУМЕНТ> {<ОПЕРАЦИЯ> <АРГУМЕНТ>}
+*/
+func (self *TSyntaxDescriptor) translateBinaryExpression(
+	AMinPriority int) (E error) {
+	if E = self.translateArgument(); E != nil {
+		return
+	}
+
+	for {
+		lit := self.lexemOperation()
+		priority := operationPriority(lit)
+		if priority == 0 || priority < AMinPriority {
+			break
 		}
 
-	case ltBelowSign:
-		lit = ltitBelow
-		if nextT == ltEqualSign {
-			self.NextLexem()
-			lit = ltitBelowEqual
-		} else if nextT == ltBelowSign {
-			self.NextLexem()
-			lit = ltitLeftShift
-		} else if nextT == ltAboveSign {
-			self.NextLexem()
-			lit = ltitNotEqual
+		if self.Lexem.Type == ltIdent {
+			self.useKeyword(self.lexemKeyword())
 		}
+		self.AppendItem(lit)
+		self.NextLexem()
 
-	default:
-		return self.Lexem.errorAt(ESyntaxError)
+		// у правоассоциативной операции правый операнд может содержать
+		// такую же операцию
+		if !isRightAssociative(lit) {
+			priority++
+		}
+		if E = self.translateBinaryExpression(priority); E != nil {
+			return
+		}
+
+		Y := self.popOperand()
+		X := self.popOperand()
+		self.pushOperand(&TBinaryExpr{
+			TNodeBase{Pos: X.Position(), End: Y.Span().End}, lit, X, Y})
 	}
 
-	self.AppendItem(lit)
-	self.NextLexem()
 	return nil
-
 }
 
-func (self *TSyntaxDescriptor) translateExpression() (E error) {
+// Переводит выражение и возвращает его дерево
+func (self *TSyntaxDescriptor) translateExpression() (X TExpr, E error) {
 	self.Parenthesis = 0
+	self.Operands = self.Operands[:0]
 
-	// обрабатываю аргумент
-	E = self.translateArgument()
-
-	// [<ОПЕРАЦИЯ><АРГУМЕНТ>]
-	for E == nil {
-		E = self.translateOperation()
-		if E != nil {
-			E = nil
-			break
-		}
-		E = self.translateArgument()
+	if E = self.translateBinaryExpression(1); E != nil {
+		return nil, E
 	}
 
-	if E == nil {
-		if self.Parenthesis < 0 {
-			E = self.Lexem.errorAt(ETooMuchCloseRB)
-		}
-		if self.Parenthesis > 0 {
-			E = self.Lexem.errorAt(ETooMuchOpenRB)
-		}
+	if self.Lexem.Type == ltCloseParenthesis {
+		return nil, self.Lexem.errorAt(ETooMuchCloseRB)
 	}
 
-	return
+	return self.popOperand(), nil
+}
+
+// Возвращает истину для знаков присваивания: = := += -= *= /=
+func isAssignment(AType TLexemType) bool {
+	return AType == ltEqualSign || AType == ltAssign ||
+		compoundOperation(AType) != ltitUnknown
+}
+
+// Возвращает операцию составного присваивания: += -= *= /=
+func compoundOperation(AType TLexemType) TLanguageItemType {
+	switch AType {
+	case ltPlusAssign:
+		return ltitMathAdd
+	case ltMinusAssign:
+		return ltitMathSub
+	case ltStarAssign:
+		return ltitMathMul
+	case ltSlashAssign:
+		return ltitMathDiv
+	}
+	return ltitUnknown
 }
 
 /*
 BNF-определения для присваивания выражения переменной
-<СЛОЖНЫЙ ИДЕНТИФИКАТОР> '=' <ВЫРАЖЕНИЕ>
+<СЛОЖНЫЙ ИДЕНТИФИКАТОР> <ПРИСВАИВАНИЕ> <ВЫРАЖЕНИЕ>
+ПРИСВАИВАНИЕ = '=' | ':=' | '+=' | '-=' | '*=' | '/='
 СЛОЖНЫЙ ИДЕНТИФИКАТОР = <ИДЕНТИФИКАТОР> {' ' <ИДЕНТИФИКАТОР>}
 ВЫРАЖЕНИЕ = <АРГУМЕНТ> {<ОПЕРАЦИЯ> <АРГУМЕНТ>}
 СЛОЖНЫЙ АРГУМЕНТ = [<УНАРНАЯ ОПЕРАЦИЯ>] <АРГУМЕНТ>
 ОПЕРАЦИЯ = '+' | '-' | '*' | '/' | '%' | '^'
 УНАРНАЯ ОПЕРАЦИЯ = '!'
 */
-func (Self *TSyntaxDescriptor) translateAssignment() (E error) {
-	E = Self.translateComplexIdent()
+func (Self *TSyntaxDescriptor) translateAssignment() (A *TAssignStmt,
+	E error) {
+	A = &TAssignStmt{TNodeBase: TNodeBase{Pos: Self.Lexem.Position()}}
+
+	A.Target, E = Self.translateComplexIdent()
 	if E != nil {
-		return Self.Lexem.errorAt(ESyntaxError)
+		return nil, Self.Lexem.errorAt(ESyntaxError)
 	}
 
-	if Self.Lexem.Type == ltEqualSign {
-		Self.AppendItem(ltitAssignment)
-		Self.NextLexem() // пропускаю знак =
-	} else {
-		return Self.Lexem.errorAt(ESyntaxError)
+	if !isAssignment(Self.Lexem.Type) {
+		return nil, Self.Lexem.errorAt(ESyntaxError)
+	}
+	// для А += Б записываются элементы А = А + (Б)
+	op := compoundOperation(Self.Lexem.Type)
+	Self.AppendItem(ltitAssignment)
+	if op != ltitUnknown {
+		Self.appendIdentAt(A.Target.Span(), A.Target.Name)
+		Self.AppendItem(op)
+		Self.AppendItem(ltitOpenParenthesis)
 	}
+	Self.NextLexem() // пропускаю знак присваивания
 
 	if Self.Lexem.Type == ltEOF {
-		return Self.Lexem.errorAt(EExpectedExpression)
+		return nil, Self.Lexem.errorAt(EExpectedExpression)
+	}
+	Self.skipEOL()
+
+	if A.Value, E = Self.translateExpression(); E != nil {
+		return nil, E
 	}
-	Self.Lexem = Self.Lexem.skipEOL()
 
-	E = Self.translateExpression()
+	if op != ltitUnknown {
+		Self.AppendItem(ltitCloseParenthesis)
+		A.Value = &TBinaryExpr{TNodeBase{Pos: A.Pos, End: Self.LastEnd}, op,
+			A.Target, A.Value}
+	}
+	A.End = Self.LastEnd
 
-	return
+	return A, nil
 }
 
 func (self *TSyntaxDescriptor) begin() {
 	self.BeginCount++
+	self.Blocks = append(self.Blocks, self.Lexem.Span)
 	self.AppendItem(ltitBegin)
 	self.NextLexem()
 }
 
 func (self *TSyntaxDescriptor) end() {
 	self.BeginCount--
+	if n := len(self.Blocks); n > 0 {
+		self.Blocks = self.Blocks[:n-1]
+	}
 	self.AppendItem(ltitEnd)
 	self.NextLexem()
 }
 
+// Записывает ошибку в список сообщений
+func (self *TSyntaxDescriptor) recordError(E error) {
+	if self.firstError == nil {
+		self.firstError = E
+	}
+	D := DiagnosticOf(E)
+	if n := len(self.Blocks); errors.Is(E, EExpectedCloseOper) && n > 0 {
+		block := self.Blocks[n-1]
+		D.Notes = append(D.Notes, newNote("N202", block.Start.LineNo,
+			block.Start.ColumnNo))
+		D.Labels = append(D.Labels, newLabel(block, "N201"))
+	}
+	self.Diagnostics = append(self.Diagnostics, D)
+}
+
+// Записывает ошибку чтения ReadError, а перед ней ошибки, после которых
+// чтение продолжалось, например неправильные последовательности UTF-8
+func (self *TSyntaxDescriptor) recordReadError() {
+	errs := self.Reader.Errors
+	if len(errs) == 0 || errs[0] != self.ReadError {
+		errs = append(errs[:len(errs):len(errs)], self.ReadError)
+	}
+	for _, E := range errs {
+		self.recordError(E)
+	}
+}
+
 /*
-Анализ группы операторов в программных скобках '{' '}'
+ Пропускает лексемы после ошибки до точки синхронизации: конца строки,
+ 'конец' или '}', или следующего объявления функции. Блоки, начатые в
+ пропущенном тексте, пропускаются целиком. Конец строки пропускается,
+ а 'конец' и '}' только вне блока, иначе ими закончится текущий блок.
+ AStart — лексема, с которой начался ошибочный оператор.
 */
-func (self *TSyntaxDescriptor) translateGroupOfStatements() (E error) {
-	E = nil
+func (self *TSyntaxDescriptor) synchronize(AStart *TLexem) {
+	depth := 0
+	for self.Lexem.Type != ltEOF {
+		kId := kwiUnknown
+		if self.Lexem.Type == ltIdent {
+			kId = self.keywordId(self.Lexem.LexemAsString())
+		}
+
+		switch {
+		case self.Lexem.Type == ltLBrace || kId == kwiBegin:
+			depth++
+
+		case self.Lexem.Type == ltRBrace || kId == kwiEnd:
+			if depth == 0 {
+				if self.BeginCount == 0 {
+					self.NextLexem()
+				}
+				return
+			}
+			depth--
+
+		case self.Lexem.Type == ltEOL && depth == 0:
+			self.NextLexem()
+			return
+
+		case (kId == kwiFunction || kId == kwiProcedure) &&
+			self.Lexem != AStart:
+			return
+		}
+		self.NextLexem()
+	}
+}
 
+/*
+Анализ группы операторов в программных скобках '{' '}'
+Если группа не начинается с 'начало' или '{', то переводится один оператор
+*/
+func (self *TSyntaxDescriptor) translateGroupOfStatements() (S TStmt, E error) {
 	var (
 		wasBegin bool
 		wasEnd   bool
+		stmt     TStmt
 	)
 
+	self.skipEOL()
 	wasBegin = self.Lexem.Type == ltLBrace
 	if !wasBegin && self.Lexem.Type == ltIdent {
 		S := self.Lexem.LexemAsString()
-		kId := toKeywordId(S)
+		kId := self.keywordId(S)
 		wasBegin = kId == kwiBegin
 	}
 
 	if !wasBegin {
-		return self.translateLexem()
+		L := self.Lexem
+		if S, E = self.translateLexem(); E == nil && S == nil {
+			E = L.errorAt(ESyntaxError)
+		}
+		return
 	}
 
+	B := &TBlockStmt{TNodeBase: TNodeBase{Pos: self.Lexem.Position()}}
 	self.begin()
+	// в программных скобках слова заголовка внешнего оператора не
+	// зарезервированы
+	restore := self.reserve()
+	defer restore()
 
 Loop:
 	for {
@@ -766,23 +1403,35 @@ Loop:
 			wasEnd = true
 
 		case ltEOF:
-			return self.Lexem.errorAt(EExpectedCloseOper)
+			return nil, self.Lexem.errorAt(EExpectedCloseOper)
 
 		case ltIdent:
 			S := self.Lexem.LexemAsString()
-			kId := toKeywordId(S)
+			kId := self.keywordId(S)
 			wasEnd = kId == kwiEnd
 		}
 
 		if wasEnd {
 			self.end()
+			B.End = self.LastEnd
 			break Loop
 		}
 
-		E = self.translateLexem()
+		L := self.Lexem
+		if stmt, E = self.translateLexem(); E != nil {
+			if self.ReadError != nil {
+				return nil, E
+			}
+			self.recordError(E)
+			self.synchronize(L)
+			continue
+		}
+		if stmt != nil {
+			B.List = append(B.List, stmt)
+		}
 	}
 
-	return
+	return B, nil
 }
 
 /*
@@ -792,79 +1441,487 @@ BNF-определения для оператора 'если'
 ИНАЧЕ = 'иначе' | 'else'
 ВЕТКА = <НАЧАЛО> <ОПЕРАТОРЫ> <КОНЕЦ>
 */
-func (self *TSyntaxDescriptor) translateIfStatement() (E error) {
+func (self *TSyntaxDescriptor) translateIfStatement() (I *TIfStmt, E error) {
 	S := self.Lexem.LexemAsString()
-	kId := toKeywordId(S)
+	kId := self.keywordId(S)
 	if kId != kwiIf {
-		return self.Lexem.errorAt(ESyntaxError)
+		return nil, self.Lexem.errorAt(ESyntaxError)
 	}
-	self.NextLexem()
+	I = &TIfStmt{TNodeBase: TNodeBase{Pos: self.Lexem.Position()}}
 	self.AppendItem(ltitIf)
+	self.NextLexem()
 
-	if E = self.translateExpression(); E != nil {
-		return
+	if I.Cond, E = self.translateExpression(); E != nil {
+		return nil, E
 	}
-	if E = self.translateGroupOfStatements(); E != nil {
-		return
+	if I.Then, E = self.translateGroupOfStatements(); E != nil {
+		return nil, E
+	}
+	// 'иначе' может быть записано на следующей строке
+	if self.Lexem.Type == ltEOL {
+		next := self.nextOf(self.Lexem)
+		if next.Type == ltIdent && self.keywordId(next.LexemAsString()) == kwiElse {
+			self.NextLexem()
+		}
 	}
 	S = self.Lexem.LexemAsString()
-	kId = toKeywordId(S)
+	kId = self.keywordId(S)
 	if kId == kwiElse {
-		self.NextLexem()
 		self.AppendItem(ltitElse)
-		E = self.translateGroupOfStatements()
+		self.NextLexem()
+		if I.Else, E = self.translateGroupOfStatements(); E != nil {
+			return nil, E
+		}
 	}
+	I.End = self.LastEnd
 
-	return
+	return I, nil
 }
 
-func (self *TSyntaxDescriptor) translateWhileStatement() (E error) {
+func (self *TSyntaxDescriptor) translateWhileStatement() (W *TWhileStmt,
+	E error) {
 	S := self.Lexem.LexemAsString()
-	kId := toKeywordId(S)
+	kId := self.keywordId(S)
 	if kId != kwiWhile {
-		return self.Lexem.errorAt(ESyntaxError)
+		return nil, self.Lexem.errorAt(ESyntaxError)
 	}
-	self.NextLexem()
+	W = &TWhileStmt{TNodeBase: TNodeBase{Pos: self.Lexem.Position()}}
 	self.AppendItem(ltitWhile)
+	self.NextLexem()
 
-	if E = self.translateExpression(); E != nil {
-		return
+	if W.Cond, E = self.translateExpression(); E != nil {
+		return nil, E
 	}
-	if E = self.translateGroupOfStatements(); E != nil {
-		return
+	if W.Body, E = self.translateGroupOfStatements(); E != nil {
+		return nil, E
 	}
+	W.End = self.LastEnd
 
-	return
+	return W, nil
 }
 
-func (self *TSyntaxDescriptor) translateIdent() (E error) {
-	E = nil
+/*
+BNF-определения для оператора 'вернуть'
+ВОЗВРАТ = ('вернуть' | 'return') [<ВЫРАЖЕНИЕ>]
+Выражения нет, если за словом идёт конец строки, ';', 'конец' или 'иначе'.
+'вернуть' без выражения в функции с результатом возвращает значение
+переменной 'результат', как Exit в Паскале.
+*/
+func (self *TSyntaxDescriptor) translateReturnStatement() (R *TReturnStmt,
+	E error) {
 	S := self.Lexem.LexemAsString()
-	kId := toKeywordId(S)
+	if self.keywordId(S) != kwiReturn {
+		return nil, self.Lexem.errorAt(ESyntaxError)
+	}
+	if self.function == nil {
+		return nil, self.Lexem.errorAt(EReturnOutsideFunction)
+	}
+	R = &TReturnStmt{TNodeBase: TNodeBase{Pos: self.Lexem.Position()}}
+	self.AppendItem(ltitReturn)
+	self.NextLexem()
+
+	if !self.isStatementEnd() {
+		pos := self.Lexem.Position()
+		if R.Result, E = self.translateExpression(); E != nil {
+			return nil, E
+		}
+		if self.function.Result == nil {
+			C := pos.newError(EProcedureReturnsValue)
+			C.Span = R.Result.Span()
+			return nil, C
+		}
+	}
+	R.End = self.LastEnd
+
+	return R, nil
+}
+
+// имена переменной результата функции, как Result в Паскале; регистр букв
+// не учитывается
+var resultNames = []string{"результат", "result"}
+
+func isResultName(AName string) bool {
+	AName = strings.ToLower(AName)
+	for _, S := range resultNames {
+		if S == AName {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ Проверяет, что функция с результатом возвращает значение на всех путях:
+ каждый путь заканчивается оператором 'вернуть' со значением или
+ присваивает значение переменной 'результат' до выхода из функции.
+*/
+func checkReturns(F *TFuncDecl) error {
+	assigned, falls, ok := returnState(F.Body, false)
+	if ok && (!falls || assigned) {
+		return nil
+	}
+	E := F.Name.Pos.newError(EMissingReturn)
+	E.Span = F.Name.Span()
+	return E
+}
+
+/*
+ Проходит оператор S, AAssigned — переменная результата уже получила
+ значение. Возвращает: получила ли она значение к концу S, может ли
+ выполнение продолжиться после S и все ли выходы из функции внутри S
+ возвращают значение.
+*/
+func returnState(S TStmt, AAssigned bool) (assigned, falls, ok bool) {
+	switch N := S.(type) {
+	case *TReturnStmt:
+		return AAssigned, false, N.Result != nil || AAssigned
+
+	case *TAssignStmt:
+		return AAssigned || isResultName(N.Target.Name), true, true
+
+	case *TBlockStmt:
+		assigned, falls, ok = AAssigned, true, true
+		for _, X := range N.List {
+			if !falls {
+				// недостижимые операторы
+				break
+			}
+			var okX bool
+			assigned, falls, okX = returnState(X, assigned)
+			ok = ok && okX
+		}
+		return
+
+	case *TIfStmt:
+		a1, f1, o1 := returnState(N.Then, AAssigned)
+		a2, f2, o2 := AAssigned, true, true
+		if N.Else != nil {
+			a2, f2, o2 = returnState(N.Else, AAssigned)
+		}
+		// ветка, после которой выполнение не продолжается, не влияет на
+		// значение переменной после оператора
+		assigned = (!f1 || a1) && (!f2 || a2)
+		return assigned, f1 || f2, o1 && o2
+
+	case *TWhileStmt:
+		// тело цикла может не выполниться ни разу
+		_, _, ok = returnState(N.Body, AAssigned)
+		return AAssigned, true, ok
+
+	case *TForStmt:
+		_, _, ok = returnState(N.Body, AAssigned)
+		return AAssigned, true, ok
+
+	case *TRepeatStmt:
+		// тело выполняется хотя бы один раз
+		return returnState(N.Body, AAssigned)
+	}
+	return AAssigned, true, true
+}
+
+// Возвращает истину, если текущая лексема заканчивает оператор
+func (self *TSyntaxDescriptor) isStatementEnd() bool {
+	switch self.Lexem.Type {
+	case ltEOL, ltEOF, ltSemicolon, ltRBrace:
+		return true
+	case ltIdent:
+		kId := self.keywordId(self.Lexem.LexemAsString())
+		return kId == kwiEnd || kId == kwiElse
+	}
+	return false
+}
+
+// Возвращает номер зарезервированного слова текущей лексемы или kwiUnknown
+func (self *TSyntaxDescriptor) lexemKeyword() TKeywordId {
+	if self.Lexem.Type != ltIdent {
+		return kwiUnknown
+	}
+	return self.keywordId(self.Lexem.LexemAsString())
+}
+
+/*
+BNF-определения для оператора 'для'
+ОПЕРАТОР ДЛЯ = <ДЛЯ> <ИМЯ ПЕРЕМЕННОЙ> <ОТ> <ВЫРАЖЕНИЕ> (<ДО> | <ВНИЗ ДО>)
+  <ВЫРАЖЕНИЕ> [<ШАГ> <ВЫРАЖЕНИЕ>] <ВЕТКА>
+ДЛЯ = 'для' | 'for'
+ОТ = 'от' | 'from' | '=' | ':='
+ДО = 'до' | 'to'
+ВНИЗ ДО = ('вниз' | 'down') <ДО> | 'downto'
+ШАГ = 'шаг' | 'step'
+Шаг, записанный числом, должен быть больше нуля, направление цикла задаётся
+словами 'до' и 'вниз до'. Слова от, до, вниз и шаг зарезервированы только в
+заголовке цикла, в остальном тексте они могут входить в идентификаторы.
+*/
+func (self *TSyntaxDescriptor) translateForStatement() (F *TForStmt,
+	E error) {
+	if self.lexemKeyword() != kwiFor {
+		return nil, self.Lexem.errorAt(ESyntaxError)
+	}
+	F = &TForStmt{TNodeBase: TNodeBase{Pos: self.Lexem.Position()}}
+	self.AppendItem(ltitFor)
+	self.NextLexem()
+	restore := self.reserve(kwiFrom, kwiTo, kwiDown, kwiDownTo, kwiStep)
+	defer restore()
+
+	if F.Var, E = self.translateComplexIdent(); E != nil {
+		return nil, self.Lexem.errorAt(EExpectedVarName)
+	}
+
+	if kId := self.lexemKeyword(); kId == kwiFrom {
+		self.useKeyword(kId)
+	} else if self.Lexem.Type != ltEqualSign && self.Lexem.Type != ltAssign {
+		return nil, self.Lexem.errorAt(EExpectedFrom)
+	}
+	self.AppendItem(ltitAssignment)
+	self.NextLexem()
+	if F.From, E = self.translateExpression(); E != nil {
+		return nil, E
+	}
+
+	switch self.lexemKeyword() {
+	case kwiTo:
+		self.useKeyword(kwiTo)
+	case kwiDown:
+		self.useKeyword(kwiDown)
+		self.NextLexem()
+		if self.lexemKeyword() != kwiTo {
+			return nil, self.Lexem.errorAt(EExpectedTo)
+		}
+		self.useKeyword(kwiTo)
+		F.Down = true
+	case kwiDownTo:
+		self.useKeyword(kwiDownTo)
+		F.Down = true
+	default:
+		return nil, self.Lexem.errorAt(EExpectedTo)
+	}
+	if F.Down {
+		self.AppendItem(ltitDownTo)
+	} else {
+		self.AppendItem(ltitTo)
+	}
+	self.NextLexem()
+	if F.To, E = self.translateExpression(); E != nil {
+		return nil, E
+	}
+
+	if self.lexemKeyword() == kwiStep {
+		self.useKeyword(kwiStep)
+		self.AppendItem(ltitStep)
+		self.NextLexem()
+		if F.Step, E = self.translateExpression(); E != nil {
+			return nil, E
+		}
+		if L, ok := F.Step.(*TLiteral); ok && L.Kind == ltitNumber &&
+			!L.Number.IsPositive() {
+			C := L.Pos.newError(ENonPositiveStep)
+			C.Span = L.Span()
+			return nil, C
+		}
+	}
+
+	restore()
+	if F.Body, E = self.translateGroupOfStatements(); E != nil {
+		return nil, E
+	}
+	F.End = self.LastEnd
+
+	return F, nil
+}
+
+/*
+BNF-определения для цикла с условием после тела
+ОПЕРАТОР ПОВТОРЯТЬ = <ПОВТОРЯТЬ> (<ОПЕРАТОРЫ> <ДО> <ВЫРАЖЕНИЕ>
+  | <НАЧАЛО> <ОПЕРАТОРЫ> <КОНЕЦ> (<ДО> | <ПОКА>) <ВЫРАЖЕНИЕ>)
+ПОВТОРЯТЬ = 'повторять' | 'repeat' | 'do'
+ДО = 'до' | 'until'
+ПОКА = 'пока' | 'while'
+Тело выполняется хотя бы один раз. Цикл 'до' повторяется, пока условие
+ложно, а цикл 'пока' — пока оно истинно. Условие 'пока' записывается только
+после тела в программных скобках, иначе его не отличить от вложенного
+цикла 'пока'; без скобок такое условие даёт ошибку EWhileNeedsBlock.
+В теле без программных скобок слова 'до' и 'until' заканчивают
+идентификатор, в остальном тексте они, как и 'повторять' не в начале
+оператора или перед знаком присваивания, входят в идентификаторы.
+*/
+func (self *TSyntaxDescriptor) translateRepeatStatement() (R *TRepeatStmt,
+	E error) {
+	if self.lexemKeyword() != kwiRepeat {
+		return nil, self.Lexem.errorAt(ESyntaxError)
+	}
+	R = &TRepeatStmt{TNodeBase: TNodeBase{Pos: self.Lexem.Position()}}
+	self.useKeyword(kwiRepeat)
+	self.AppendItem(ltitRepeat)
+	self.NextLexem()
+	self.skipEOL()
+
+	// тело в программных скобках, за которым сразу идёт условие
+	if self.Lexem.Type == ltLBrace || self.lexemKeyword() == kwiBegin {
+		if R.Body, E = self.translateGroupOfStatements(); E != nil {
+			return nil, E
+		}
+		self.skipEOL()
+		if kId := self.lexemKeyword(); kId == kwiWhile {
+			self.AppendItem(ltitWhile)
+			return self.translateRepeatCondition(R)
+		}
+	}
+
+	// тело без программных скобок продолжается до слова 'до'
+	restore := self.reserve(kwiTo, kwiUntil)
+	defer restore()
+	B := &TBlockStmt{TNodeBase: TNodeBase{Pos: self.Lexem.Position()}}
+	if R.Body != nil {
+		B.Pos = R.Body.Position()
+		B.List = append(B.List, R.Body)
+	}
+	for !self.isUntil() {
+		if kId := self.lexemKeyword(); self.Lexem.Type == ltEOF ||
+			self.Lexem.Type == ltRBrace || kId == kwiEnd {
+			return nil, self.Lexem.errorAt(EExpectedUntil)
+		}
+		if self.lexemKeyword() == kwiWhile && self.isLoopWhile() {
+			return nil, self.Lexem.errorAt(EWhileNeedsBlock)
+		}
+		L := self.Lexem
+		stmt, E := self.translateLexem()
+		if E != nil {
+			if self.ReadError != nil {
+				return nil, E
+			}
+			self.recordError(E)
+			self.synchronize(L)
+			continue
+		}
+		if stmt != nil {
+			B.List = append(B.List, stmt)
+		}
+	}
+	// 'повторять начало ... конец до': блок уже есть, второй не нужен
+	if len(B.List) != 1 || B.List[0] != R.Body {
+		B.End = self.LastEnd
+		R.Body = B
+	}
+	R.Until = true
+	restore()
+	// русское 'до' здесь означает until, а не to
+	self.useKeyword(kwiUntil)
+	self.AppendItem(ltitUntil)
+
+	return self.translateRepeatCondition(R)
+}
+
+/*
+ Возвращает истину, если 'пока' в теле цикла без программных скобок —
+ условие цикла, а не вложенный цикл 'пока': после него до конца текста или
+ блока нет слова 'до', которое закончило бы цикл. Слова 'до' вложенных
+ циклов 'для' и 'повторять' не считаются.
+*/
+func (self *TSyntaxDescriptor) isLoopWhile() bool {
+	depth, inner := 0, 0
+	for L := self.Lexem; L.Type != ltEOF; L = self.nextOf(L) {
+		kId := kwiUnknown
+		if L.Type == ltIdent {
+			kId = self.keywordId(L.LexemAsString())
+		}
+
+		switch {
+		case L.Type == ltLBrace || kId == kwiBegin:
+			depth++
+
+		case L.Type == ltRBrace || kId == kwiEnd:
+			if depth == 0 {
+				return true
+			}
+			depth--
+
+		case kId == kwiFor || kId == kwiRepeat:
+			inner++
+
+		case kId == kwiTo || kId == kwiDownTo || kId == kwiUntil:
+			if inner > 0 {
+				inner--
+			} else if depth == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Возвращает истину, если текущая лексема 'до' или 'until'
+func (self *TSyntaxDescriptor) isUntil() bool {
+	kId := self.lexemKeyword()
+	return kId == kwiTo || kId == kwiUntil
+}
+
+// Переводит условие цикла R после слова 'до' или 'пока'
+func (self *TSyntaxDescriptor) translateRepeatCondition(R *TRepeatStmt) (
+	*TRepeatStmt, error) {
+	var E error
+
+	self.NextLexem()
+	if R.Cond, E = self.translateExpression(); E != nil {
+		return nil, E
+	}
+	R.End = self.LastEnd
+
+	return R, nil
+}
+
+func (self *TSyntaxDescriptor) translateIdent() (S TStmt, E error) {
+	kId := self.keywordId(self.Lexem.LexemAsString())
+	// 'do = 1' — присваивание переменной, а не цикл
+	if kId == kwiRepeat && isAssignment(self.nextOf(self.Lexem).Type) {
+		kId = kwiUnknown
+	}
 	switch kId {
 	case kwiVariable:
-		E = self.translateVarList()
+		S, E = self.translateVarList()
 
-	case kwiFunction:
-		E = self.translateFunctionDeclaration()
+	case kwiFunction, kwiProcedure:
+		S, E = self.translateFunctionDeclaration()
 
 	case kwiBegin:
-		self.begin()
+		S, E = self.translateGroupOfStatements()
 
 	case kwiEnd:
-		self.end()
+		E = self.Lexem.errorAt(EUnExpectedKeyword)
 
 	case kwiIf:
-		E = self.translateIfStatement()
+		S, E = self.translateIfStatement()
 
 	case kwiWhile:
-		E = self.translateWhileStatement()
+		S, E = self.translateWhileStatement()
+
+	case kwiReturn:
+		S, E = self.translateReturnStatement()
+
+	case kwiFor:
+		S, E = self.translateForStatement()
+
+	case kwiRepeat:
+		S, E = self.translateRepeatStatement()
 
 	default:
-		self.NextLexem()
+		// оператор начинается с имени функции или переменной, значит это
+		// вызов функции или присваивание
+		self.StartLexem = self.Lexem
+		if self.isCall() {
+			S, E = self.translateCallStatement()
+		} else {
+			S, E = self.translateAssignment()
+		}
+		// при чтении из Reader пройденные лексемы не удерживаются
+		if self.Reader != nil {
+			self.StartLexem = nil
+		}
 	}
 
-	return
+	if E != nil {
+		return nil, E
+	}
+	return S, nil
 }
 
 /*
@@ -872,57 +1929,130 @@ func (self *TSyntaxDescriptor) translateIdent() (E error) {
 Например, после for должна быть инициализация переменной цикла, 'to',
 <ВЫРАЖЕНИЕ>, возможно шаг,
 возможно 'begin', далее идёт всё что угодно, вот тут translateLexem и нужен
+Возвращает nil вместо оператора, если лексема пропущена
 */
-func (self *TSyntaxDescriptor) translateLexem() (E error) {
-	E = nil
+func (self *TSyntaxDescriptor) translateLexem() (S TStmt, E error) {
 	switch self.Lexem.Type {
 	case ltIdent:
-		E = self.translateIdent()
+		S, E = self.translateIdent()
 
-	case ltEqualSign:
-		self.Lexem = self.StartLexem
-		E = self.translateAssignment()
+	// знак присваивания в начале оператора: имя переменной осталось в
+	// предыдущем операторе, например в границе цикла без 'начало'
+	case ltEqualSign, ltAssign, ltPlusAssign, ltMinusAssign, ltStarAssign,
+		ltSlashAssign:
+		E = self.Lexem.errorAt(EExpectedVarName)
 
 	case ltEOL:
 		self.NextLexem()
 
 	case ltLBrace:
-		self.begin()
+		S, E = self.translateGroupOfStatements()
 
 	case ltRBrace:
-		self.end()
+		E = self.Lexem.errorAt(ESyntaxError)
 
 	default:
 		if self.Lexem.Size > 0 {
-			fmt.Printf("Лехема: %d size: %d %s ",
-				self.Lexem.Type, self.Lexem.Size, self.Lexem.LexemAsString())
+			self.Diagnostics = append(self.Diagnostics, newDiagnostic(
+				SeverityWarning, self.Lexem.Span, "W201",
+				self.Lexem.LexemAsString()))
 		}
 		self.NextLexem()
 	}
 
-	return
+	if E != nil {
+		return nil, E
+	}
+	return S, nil
 }
 
-/*
- Переводит текст в лексемах в массив элементов языка
-*/
-func TranslateCode(ALexem PLexem) (TSyntaxDescriptor, error) {
-	sd := TSyntaxDescriptor{
+func newSyntaxDescriptor(ALexem PLexem) TSyntaxDescriptor {
+	return TSyntaxDescriptor{
 		Lexem:         ALexem,
 		StartLexem:    ALexem,
 		LanguageItems: make([]TLanguageItem, 0, 1000),
 		Parenthesis:   0,
 		BeginCount:    0,
 		StrNumbers:    make([]string, 0, 1024),
+		Numbers:       make([]TNumberValue, 0, 1024),
 		StrIdents:     make([]string, 0, 1024),
 		StrStrings:    make([]string, 0, 1024),
+		Program:       &TProgram{},
 	}
+}
 
-	for sd.Lexem != nil && sd.Lexem.Type != ltEOF {
-		if E := sd.translateLexem(); E != nil {
-			return TSyntaxDescriptor{}, E
+func (self *TSyntaxDescriptor) translateProgram() error {
+	if self.Lexem != nil {
+		self.Program.Pos = self.Lexem.Position()
+	}
+
+	for self.Lexem != nil && self.Lexem.Type != ltEOF {
+		L := self.Lexem
+		S, E := self.translateLexem()
+		// ошибка перевода может быть следствием ошибки чтения, после
+		// ошибки чтения перевод продолжить нельзя
+		if self.ReadError != nil {
+			self.recordReadError()
+			return self.firstError
+		}
+		if E != nil {
+			self.recordError(E)
+			self.BeginCount = 0
+			self.Blocks = self.Blocks[:0]
+			self.synchronize(L)
+			continue
 		}
+		if S != nil {
+			self.Program.List = append(self.Program.List, S)
+		}
+	}
+	self.Program.End = self.LastEnd
+
+	return self.firstError
+}
+
+/*
+ Переводит текст в лексемах в массив элементов языка и синтаксическое
+ дерево программы. После ошибки перевод продолжается со следующей точки
+ синхронизации, все ошибки записываются в sd.Diagnostics, а возвращается
+ первая из них.
+*/
+func TranslateCode(ALexem PLexem) (TSyntaxDescriptor, error) {
+	return TranslateCodeWith(ALexem, nil)
+}
+
+/*
+ Переводит текст в лексемах с набором зарезервированных слов AKeywords,
+ например с набором из прагмы, прочитанной TReader.BuildLexems:
+ TranslateCodeWith(L, R.Keywords)
+*/
+func TranslateCodeWith(ALexem PLexem, AKeywords *TKeywordSet) (
+	TSyntaxDescriptor, error) {
+	sd := newSyntaxDescriptor(ALexem)
+	sd.Keywords = AKeywords
+	E := sd.translateProgram()
+	return sd, E
+}
+
+/*
+ Переводит текст, читая лексемы из AReader по мере перевода. Лексемы
+ переведённых операторов не удерживаются, в памяти остаются лексемы
+ переводимого оператора верхнего уровня, например всей функции, и текст,
+ прочитанный AReader. Синтаксические ошибки собираются, как в
+ TranslateCode, а при ошибке чтения перевод прекращается, не дочитывая
+ текст.
+*/
+func TranslateReader(AReader *TReader) (TSyntaxDescriptor, error) {
+	L, E := AReader.NextLexem()
+	if E != nil {
+		return TSyntaxDescriptor{}, E
 	}
 
-	return sd, nil
+	sd := newSyntaxDescriptor(L)
+	sd.StartLexem = nil
+	sd.Reader = AReader
+	E = sd.translateProgram()
+	sd.Reader = nil
+	sd.Keywords = AReader.Keywords
+	return sd, E
 }
@@ -0,0 +1,121 @@
+package lsa
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Каталог сообщений об ошибках. Текст сообщения выбирается по постоянному
+// коду ошибки и языку, который задаётся отдельно для каждого вывода
+// сообщений, например в TRenderer.Language.
+
+type TLanguage uint
+
+const (
+	LanguageRussian TLanguage = iota
+	LanguageEnglish
+)
+
+var languageNames = map[string]TLanguage{
+	"ru":         LanguageRussian,
+	"русский":    LanguageRussian,
+	"russian":    LanguageRussian,
+	"en":         LanguageEnglish,
+	"английский": LanguageEnglish,
+	"english":    LanguageEnglish,
+}
+
+/*
+ Тексты сообщений: русский и английский. Коды E1xx — ошибки лексического
+ анализа, E2xx — синтаксиса, E3xx — генерации, W — предупреждения,
+ N — примечания и пометки. Коды не меняются, на них могут ссылаться
+ другие программы.
+*/
+var messageCatalogue = map[string][2]string{
+	"E101": {"Незакрытая строка, ожидается \"", "Unterminated string, expected \""},
+	"E102": {"Незакрытый символ, ожидается '", "Unterminated character, expected '"},
+	"E103": {"Неправильная запись числа", "Malformed number"},
+	"E104": {"Слишком большое число", "Number is too large"},
+	"E105": {"Неправильная спец. последовательность", "Invalid escape sequence"},
+	"E106": {"Символ должен состоять из одного знака", "Character literal must contain exactly one character"},
+	"E107": {"Незакрытый комментарий, ожидается */", "Unterminated comment, expected */"},
+	"E108": {"Неправильная последовательность UTF-8", "Invalid UTF-8 sequence"},
+	"E109": {"Неизвестная кодировка", "Unknown encoding"},
+	"E110": {"Неизвестный набор ключевых слов", "Unknown keyword set"},
+	"E111": {"Неправильная строка файла ключевых слов", "Malformed line in keyword file"},
+	"E112": {"Идентификатор совпадает с зарезервированным словом нового набора", "Identifier is a keyword in the target keyword set"},
+
+	"E201": {"Отсутствует выражение после знака =", "Expression expected after ="},
+	"E202": {"Синтаксическая ошибка", "Syntax error"},
+	"E203": {"Ожидается операнд", "Operand expected"},
+	"E204": {"Слишком много )", "Too many )"},
+	"E205": {"Слишком много (", "Too many ("},
+	"E206": {"Отсутствует 'конец'", "Missing 'end'"},
+	"E207": {"Встретилось зарезервированное слово", "Unexpected keyword"},
+	"E208": {"Ожидается тип", "Type expected"},
+	"E209": {"Отсутствует имя параметра", "Parameter name expected"},
+	"E210": {"Не указан тип параметра", "Parameter type is missing"},
+	"E211": {"Ожидается ')'", "')' expected"},
+	"E212": {"Ожидается имя переменной", "Variable name expected"},
+	"E213": {"Ожидается идентификатор", "Identifier expected"},
+	"E214": {"Ожидается тип переменной", "Variable type expected"},
+	"E215": {"Оператор 'вернуть' вне функции", "'return' outside of a function"},
+	"E216": {"Процедура не возвращает значение", "Procedure cannot return a value"},
+	"E217": {"У процедуры не может быть результата", "Procedure cannot have a result type"},
+	"E218": {"Функция возвращает значение не на всех путях", "Function does not return a value on all paths"},
+	"E219": {"Ожидается 'от' или '='", "'from' or '=' expected"},
+	"E220": {"Ожидается 'до' или 'вниз до'", "'to' or 'downto' expected"},
+	"E221": {"Шаг цикла должен быть больше нуля, для счёта вниз используйте 'вниз до'", "Loop step must be positive, use 'downto' to count down"},
+	"E222": {"Ожидается 'до' или 'пока' после тела цикла", "'until' or 'while' expected after the loop body"},
+	"E223": {"Условие 'пока' после тела цикла требует тела в программных скобках: повторять начало ... конец пока", "'while' after the loop body requires a body in braces: do { ... } while"},
+
+	"E301": {"Вложенные функции не поддерживаются", "Nested functions are not supported"},
+	"E302": {"Неизвестный узел синтаксического дерева", "Unknown syntax tree node"},
+	"E303": {"Операция не поддерживается", "Operation is not supported"},
+	"E304": {"Число не помещается в 64 бита", "Number does not fit in 64 bits"},
+
+	"W201": {"Лексема пропущена: %s", "Lexeme skipped: %s"},
+
+	"N201": {"здесь начинается блок", "block starts here"},
+	"N202": {"[%d:%d] здесь начинается блок", "[%d:%d] block starts here"},
+}
+
+var severityLanguageNames = [...][3]string{
+	LanguageRussian: {"ошибка", "предупреждение", "примечание"},
+	LanguageEnglish: {"error", "warning", "note"},
+}
+
+// Возвращает язык по названию: ru, en, русский, english, ...
+func LanguageByName(AName string) (TLanguage, bool) {
+	L, ok := languageNames[strings.ToLower(strings.TrimSpace(AName))]
+	return L, ok
+}
+
+/*
+ Возвращает текст сообщения с кодом ACode на языке ALanguage, AArgs
+ подставляются в текст. Для неизвестного кода возвращается сам код.
+*/
+func Message(ACode string, ALanguage TLanguage, AArgs ...interface{}) string {
+	texts, ok := messageCatalogue[ACode]
+	if !ok {
+		return ACode
+	}
+	if int(ALanguage) >= len(texts) {
+		ALanguage = LanguageRussian
+	}
+	if len(AArgs) == 0 {
+		return texts[ALanguage]
+	}
+	return fmt.Sprintf(texts[ALanguage], AArgs...)
+}
+
+// Создаёт ошибку пакета с текстом из каталога
+func newError(ACode string) *lsaError {
+	return &lsaError{Code: ACode, Msg: Message(ACode, LanguageRussian)}
+}
+
+// Возвращает текст ошибки без положения на языке ALanguage
+func ErrorMessage(E error, ALanguage TLanguage) string {
+	D := DiagnosticOf(E).Localize(ALanguage)
+	return D.Msg
+}
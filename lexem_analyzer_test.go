@@ -1,9 +1,11 @@
 package lsa
 
 import (
+	"errors"
 	"fmt"
 	"github.com/biorhitm/memfs"
 	"io"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -256,6 +258,85 @@ func TestNumberParser(t *testing.T) {
 	}
 }
 
+func TestNumberLiterals(t *testing.T) {
+	numbers := []struct {
+		Text  string
+		Type  TLexemType
+		Value string
+	}{
+		{"0", ltNumber, "0"},
+		{"1_000_000", ltNumber, "1000000"},
+		{"0x1F", ltNumber, "31"},
+		{"0XfF", ltNumber, "255"},
+		{"0b1010", ltNumber, "10"},
+		{"0o17", ltNumber, "15"},
+		{"017", ltNumber, "15"},
+		{"9223372036854775807", ltNumber, "9223372036854775807"},
+		{"18446744073709551616", ltNumber, "18446744073709551616"},
+		{"3.14", ltFloat, "3.14"},
+		{"314E-2", ltFloat, "3.14"},
+		{"3e+3", ltFloat, "3000.0"},
+		{"1.0", ltFloat, "1.0"},
+		{"0.5", ltFloat, "0.5"},
+		{"1_0.2_5", ltFloat, "10.25"},
+	}
+
+	for _, N := range numbers {
+		L, E := stringToLexems(N.Text)
+		if E != nil {
+			t.Errorf("%s: %s", N.Text, E.Error())
+			continue
+		}
+		if L.Type != N.Type {
+			t.Errorf("%s: неправильный тип: %d", N.Text, L.Type)
+		}
+		if S := (*L).LexemAsString(); S != N.Text {
+			t.Errorf("%s: лексема содержит неправильный текст: \"%s\"", N.Text, S)
+		}
+		if S := L.Number.String(); S != N.Value {
+			t.Errorf("%s: неправильное значение %s, ожидается %s", N.Text, S, N.Value)
+		}
+		if L.Next == nil || L.Next.Type != ltEOF {
+			t.Errorf("%s: число прочитано не полностью", N.Text)
+		}
+	}
+
+	// точка без цифры после неё не относится к числу
+	L, E := stringToLexems("1..10")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	types := []TLexemType{ltNumber, ltRange, ltNumber, ltEOF}
+	for i, T := range types {
+		if L == nil || L.Type != T {
+			t.Fatalf("1..10: лексема %d должна иметь тип %d", i, T)
+		}
+		L = L.Next
+	}
+
+	wrongNumbers := []struct {
+		Text string
+		E    *lsaError
+	}{
+		{"0x", EInvalidNumber},
+		{"0b102", EInvalidNumber},
+		{"019", EInvalidNumber},
+		{"1__0", EInvalidNumber},
+		{"10_", EInvalidNumber},
+		{"1e", EInvalidNumber},
+		{"1.5e+", EInvalidNumber},
+		{"12abc", EInvalidNumber},
+		{"1e400", ENumberOverflow},
+	}
+
+	for _, N := range wrongNumbers {
+		_, E := stringToLexems(N.Text)
+		if !errors.Is(E, N.E) {
+			t.Errorf("%s: ожидается ошибка \"%s\", получено: %v", N.Text, N.E.Msg, E)
+		}
+	}
+}
+
 func TestStringParser(t *testing.T) {
 	var S string = "\tА = \"Привет мир!\"\r\n"
 	buf, _ := stringToUTF8EncodedByteArray(S)
@@ -365,12 +446,278 @@ func TestCharParser(t *testing.T) {
 	}
 }
 
-func ExampleUnterminatedStringError() {
+func TestEscapeSequences(t *testing.T) {
+	literals := []struct {
+		Text  string
+		Type  TLexemType
+		Value string
+	}{
+		{`"a\"b"`, ltString, "a\"b"},
+		{`"\\\n\t\r\0"`, ltString, "\\\n\t\r\x00"},
+		{`"\a\b\f\v\'"`, ltString, "\a\b\f\v'"},
+		{`"\x41\u{416}\u{1F600}"`, ltString, "AЖ😀"},
+		// \xHH — байт, как в СИ, а не символ U+00HH
+		{`"\xFF\xd0\xaf"`, ltString, "\xffЯ"},
+		{`'\xFF'`, ltChar, "\xff"},
+		{`""`, ltString, ""},
+		{`'\''`, ltChar, "'"},
+		{`'\n'`, ltChar, "\n"},
+		{`'Ж'`, ltChar, "Ж"},
+		{`'\u{44f}'`, ltChar, "я"},
+	}
+
+	for _, N := range literals {
+		L, E := stringToLexems(N.Text)
+		if E != nil {
+			t.Errorf("%s: %s", N.Text, E.Error())
+			continue
+		}
+		if L.Type != N.Type {
+			t.Errorf("%s: неправильный тип: %d", N.Text, L.Type)
+		}
+		if L.Value != N.Value {
+			t.Errorf("%s: значение %q, ожидается %q", N.Text, L.Value, N.Value)
+		}
+		if L.Next == nil || L.Next.Type != ltEOF {
+			t.Errorf("%s: константа прочитана не полностью", N.Text)
+		}
+	}
+
+	wrongLiterals := []struct {
+		Text string
+		E    *lsaError
+		Pos  TPosition
+	}{
+		{"А = \"ab\\q\"", EInvalidEscape, TPosition{LineNo: 0, ColumnNo: 7}},
+		{"\n \"\\x4\"", EInvalidEscape, TPosition{LineNo: 1, ColumnNo: 2}},
+		{`"\u{}"`, EInvalidEscape, TPosition{LineNo: 0, ColumnNo: 1}},
+		{`"\u41"`, EInvalidEscape, TPosition{LineNo: 0, ColumnNo: 1}},
+		{`"\u{110000}"`, EInvalidEscape, TPosition{LineNo: 0, ColumnNo: 1}},
+		{`"\u{D800}"`, EInvalidEscape, TPosition{LineNo: 0, ColumnNo: 1}},
+		{`"\u{1234567}"`, EInvalidEscape, TPosition{LineNo: 0, ColumnNo: 1}},
+		{`"abc\"`, EUnterminatedString, TPosition{LineNo: 0, ColumnNo: 0}},
+		{`''`, ECharLength, TPosition{LineNo: 0, ColumnNo: 0}},
+		{`'ab'`, ECharLength, TPosition{LineNo: 0, ColumnNo: 0}},
+	}
+
+	for _, N := range wrongLiterals {
+		_, E := stringToLexems(N.Text)
+		if !errors.Is(E, N.E) {
+			t.Errorf("%s: ожидается ошибка \"%s\", получено: %v", N.Text, N.E.Msg, E)
+			continue
+		}
+		lsaE := E.(*lsaError)
+		if lsaE.LineNo != N.Pos.LineNo || lsaE.ColumnNo != N.Pos.ColumnNo {
+			t.Errorf("%s: ошибка в [%d:%d], ожидается [%d:%d]", N.Text,
+				lsaE.LineNo, lsaE.ColumnNo, N.Pos.LineNo, N.Pos.ColumnNo)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	S := "А = Б / В // деление\n" +
+		"/* блок /* вложенный */ ещё */ { Г }/**/\n" +
+		"// в конце"
+	buf, _ := stringToUTF8EncodedByteArray(S)
+	R := TReader{
+		Text:         memfs.PBigByteArray(unsafe.Pointer(&buf[0])),
+		Size:         uint64(len(buf)),
+		KeepComments: true,
+	}
+
+	L, E := R.BuildLexems()
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	lexems := []struct {
+		Type     TLexemType
+		Comments []string
+	}{
+		{ltIdent, nil},
+		{ltEqualSign, nil},
+		{ltIdent, nil},
+		{ltSlash, nil},
+		{ltIdent, nil},
+		{ltEOL, []string{"// деление"}},
+		{ltLBrace, []string{"/* блок /* вложенный */ ещё */"}},
+		{ltIdent, nil},
+		{ltRBrace, nil},
+		{ltEOL, []string{"/**/"}},
+		{ltEOF, []string{"// в конце"}},
+	}
+
+	for i, N := range lexems {
+		if L == nil {
+			t.Fatal("Мало лексем")
+		}
+		if L.Type != N.Type {
+			t.Fatalf("Лексема %d: неправильный тип: %d", i, L.Type)
+		}
+		C := L.Comments
+		for _, text := range N.Comments {
+			if C == nil || C.Type != ltComment || (*C).LexemAsString() != text {
+				t.Fatalf("Лексема %d: нет комментария \"%s\"", i, text)
+			}
+			C = C.Next
+		}
+		if C != nil {
+			t.Fatalf("Лексема %d: лишний комментарий", i)
+		}
+		L = L.Next
+	}
+
+	L, _ = stringToLexems("А = 1 /* коммент */ + 2")
+	for ; L != nil; L = L.Next {
+		if L.Comments != nil {
+			t.Fatal("Комментарии сохранены без KeepComments")
+		}
+	}
+
+	_, E = stringToLexems("А = 1\n  /* внешний /* вложенный */")
+	if !errors.Is(E, EUnterminatedComment) {
+		t.Fatalf("Ожидается ошибка EUnterminatedComment, получено: %v", E)
+	}
+	if lsaE := E.(*lsaError); lsaE.LineNo != 1 || lsaE.ColumnNo != 2 {
+		t.Errorf("Неправильное положение ошибки: %s", E.Error())
+	}
+}
+
+func TestOperatorLexems(t *testing.T) {
+	L, E := stringToLexems(
+		"А>=Б <= <> << >> := == != += -= *= /= ** .. > = < < ! = / / 1 && || & |")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	lexems := []struct {
+		Type     TLexemType
+		Text     string
+		ColumnNo uint
+	}{
+		{ltIdent, "А", 0},
+		{ltAboveOrEqual, ">=", 1},
+		{ltIdent, "Б", 3},
+		{ltBelowOrEqual, "<=", 5},
+		{ltNotEqual, "<>", 8},
+		{ltLeftShift, "<<", 11},
+		{ltRightShift, ">>", 14},
+		{ltAssign, ":=", 17},
+		{ltDoubleEqual, "==", 20},
+		{ltExclamationEqual, "!=", 23},
+		{ltPlusAssign, "+=", 26},
+		{ltMinusAssign, "-=", 29},
+		{ltStarAssign, "*=", 32},
+		{ltSlashAssign, "/=", 35},
+		{ltPower, "**", 38},
+		{ltRange, "..", 41},
+		{ltAboveSign, "", 44},
+		{ltEqualSign, "", 46},
+		{ltBelowSign, "", 48},
+		{ltBelowSign, "", 50},
+		{ltExclamationMark, "", 52},
+		{ltEqualSign, "", 54},
+		{ltSlash, "", 56},
+		{ltSlash, "", 58},
+		{ltNumber, "1", 60},
+		{ltLogicalAnd, "&&", 62},
+		{ltLogicalOr, "||", 65},
+		{ltAmpersand, "", 68},
+		{ltVerticalLine, "", 70},
+		{ltEOF, "", 0},
+	}
+
+	for i, N := range lexems {
+		if L == nil {
+			t.Fatal("Мало лексем")
+		}
+		if L.Type != N.Type || (*L).LexemAsString() != N.Text ||
+			(N.Type != ltEOF && L.ColumnNo != N.ColumnNo) {
+			t.Fatalf("Лексема %d: тип %d '%s' в колонке %d, ожидается %d '%s' в колонке %d",
+				i, L.Type, (*L).LexemAsString(), L.ColumnNo, N.Type, N.Text, N.ColumnNo)
+		}
+		L = L.Next
+	}
+}
+
+func TestOwnedTextReaders(t *testing.T) {
+	S := "Длина = 2 * Пи /* коммент */ * \"Р\""
+	data := []byte(S)
+	R := NewBytesReader(data)
+	R.KeepComments = true
+	L, E := R.BuildLexems()
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	// лексемы не должны зависеть от исходного буфера
+	for i := range data {
+		data[i] = ' '
+	}
+
+	texts := []string{"Длина", "", "2", "", "Пи", "", "Р", ""}
+	offsets := []uint64{0, 11, 13, 15, 17, 43, 46, 49}
+	for i, text := range texts {
+		if L == nil {
+			t.Fatal("Мало лексем")
+		}
+		if L.Text != nil || (*L).LexemAsString() != text || L.Offset != offsets[i] {
+			t.Errorf("Лексема %d: '%s' по смещению %d, ожидается '%s' по смещению %d",
+				i, (*L).LexemAsString(), L.Offset, text, offsets[i])
+		}
+		if L.Type == ltStar && L.Offset == 43 {
+			if L.Comments == nil || (*L.Comments).LexemAsString() != "/* коммент */" {
+				t.Errorf("Нет комментария")
+			}
+		}
+		L = L.Next
+	}
+
+	R, E = NewReader(strings.NewReader(S))
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	if L, E = R.BuildLexems(); E != nil || (*L).LexemAsString() != "Длина" {
+		t.Errorf("NewReader: неправильная лексема, ошибка: %v", E)
+	}
+
+	fileName := filepath.Join(t.TempDir(), "test.l")
+	if E = os.WriteFile(fileName, []byte(S), 0644); E != nil {
+		t.Fatal(E.Error())
+	}
+	if R, E = NewFileReader(fileName); E != nil {
+		t.Fatal(E.Error())
+	}
+	if L, E = R.BuildLexems(); E != nil || (*L).LexemAsString() != "Длина" {
+		t.Errorf("NewFileReader: неправильная лексема, ошибка: %v", E)
+	}
+	if _, E = NewFileReader(fileName + ".нет"); E == nil {
+		t.Error("Нет ошибки для несуществующего файла")
+	}
+
+	if L, E = NewBytesReader(nil).BuildLexems(); E != nil || L.Type != ltEOF {
+		t.Errorf("Пустой текст: %v", E)
+	}
+
+	// текст копируется при создании, изменение буфера до разбора не влияет
+	data = []byte(S)
+	R = NewBytesReader(data)
+	for i := range data {
+		data[i] = ' '
+	}
+	if L, E = R.BuildLexems(); E != nil || (*L).LexemAsString() != "Длина" {
+		t.Errorf("Буфер изменён до разбора: неправильная лексема, ошибка: %v", E)
+	}
+	if R.SourceText() != S {
+		t.Errorf("SourceText: '%s', ожидается '%s'", R.SourceText(), S)
+	}
+}
+
+func Example_unterminatedStringError() {
 	S := "\n\nС = \"test"
 	_, E := stringToLexems(S)
-	if E != EUnterminatedString {
+	if !errors.Is(E, EUnterminatedString) {
 		_, file, line, _ := runtime.Caller(0)
-		fmt.Printf("[%v:%v] E != EUnterminatedString\n ", filepath.Base(file), line)
+		fmt.Printf("[%v:%v] !errors.Is(E, EUnterminatedString)\n ", filepath.Base(file), line)
 	}
 	if E != nil {
 		fmt.Print(E.Error())
@@ -379,12 +726,12 @@ func ExampleUnterminatedStringError() {
 	//Output: [2:4] Незакрытая строка, ожидается "
 }
 
-func ExampleUnterminatedCharError() {
+func Example_unterminatedCharError() {
 	S := "\n\n\n\n\n\n\nСимвол = '$"
 	_, E := stringToLexems(S)
-	if E != EUnterminatedChar {
+	if !errors.Is(E, EUnterminatedChar) {
 		_, file, line, _ := runtime.Caller(0)
-		fmt.Printf("[%v:%v] E != EUnterminatedChar\n ", filepath.Base(file), line)
+		fmt.Printf("[%v:%v] !errors.Is(E, EUnterminatedChar)\n ", filepath.Base(file), line)
 	}
 	if E != nil {
 		fmt.Print(E.Error())
@@ -392,3 +739,300 @@ func ExampleUnterminatedCharError() {
 	}
 	//Output: [7:9] Незакрытый символ, ожидается '
 }
+
+func TestNextLexem(t *testing.T) {
+	R := NewBytesReader([]byte("А = 1\n\n  Б\n  "))
+	types := []TLexemType{ltIdent, ltEqualSign, ltNumber, ltEOL, ltIdent,
+		ltEOF, ltEOF}
+	for i, T := range types {
+		L, E := R.NextLexem()
+		if E != nil {
+			t.Fatal(E.Error())
+		}
+		if L.Type != T || L.Next != nil {
+			t.Fatalf("Лексема %d: тип %d, ожидается %d", i, L.Type, T)
+		}
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	text := []byte("А = \xFF\nБ = \"ж\xC0\xAFж\"")
+
+	// по умолчанию неправильные байты пропускаются
+	L, E := NewBytesReader(text).BuildLexems()
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	for ; L.Type != ltString; L = L.Next {
+		if L.Type == ltInvalidChar {
+			t.Fatal("Лексема ltInvalidChar в режиме UTF8Skip")
+		}
+	}
+	if L.Value != "жж" {
+		t.Errorf("Строка: %q", L.Value)
+	}
+
+	R := NewBytesReader(text)
+	R.UTF8Mode = UTF8Strict
+	_, E = R.BuildLexems()
+	if !errors.Is(E, EInvalidUTF8) || !errors.Is(E, InvalidRune) {
+		t.Fatalf("Ожидается ошибка EInvalidUTF8, получено: %v", E)
+	}
+	if lsaE := E.(*lsaError); lsaE.LineNo != 0 || lsaE.ColumnNo != 4 ||
+		lsaE.Offset != 5 {
+		t.Errorf("Неправильное положение ошибки: %s, смещение %d",
+			E.Error(), lsaE.Offset)
+	}
+
+	// чтение продолжается, каждая последовательность даёт свою ошибку
+	positions := []struct {
+		LineNo, ColumnNo uint
+		Offset           uint64
+	}{{0, 4, 5}, {1, 6, 15}}
+	if len(R.Errors) != len(positions) || E != R.Errors[0] {
+		t.Fatalf("Получено ошибок: %d, ожидается %d", len(R.Errors),
+			len(positions))
+	}
+	for i, P := range positions {
+		lsaE := R.Errors[i].(*lsaError)
+		if !errors.Is(lsaE, EInvalidUTF8) || lsaE.LineNo != P.LineNo ||
+			lsaE.ColumnNo != P.ColumnNo || lsaE.Offset != P.Offset {
+			t.Errorf("Ошибка %d: %v, смещение %d", i, lsaE, lsaE.Offset)
+		}
+	}
+
+	R = NewBytesReader(text[7:])
+	R.UTF8Mode = UTF8Strict
+	_, E = R.BuildLexems()
+	if !errors.Is(E, EInvalidUTF8) {
+		t.Fatalf("Ожидается ошибка EInvalidUTF8, получено: %v", E)
+	}
+	if lsaE := E.(*lsaError); lsaE.LineNo != 0 || lsaE.ColumnNo != 6 ||
+		lsaE.Offset != 8 {
+		t.Errorf("Ошибка в строке: %v, смещение %d", E, lsaE.Offset)
+	}
+
+	R = NewBytesReader(text)
+	R.UTF8Mode = UTF8Lenient
+	if L, E = R.BuildLexems(); E != nil {
+		t.Fatal(E.Error())
+	}
+	L = L.Next.Next
+	if L.Type != ltInvalidChar || L.Offset != 5 || L.ColumnNo != 4 ||
+		(*L).LexemAsString() != "\xFF" {
+		t.Fatalf("Неправильная лексема: тип %d, смещение %d", L.Type, L.Offset)
+	}
+	for ; L.Type != ltString; L = L.Next {
+	}
+	if L.Value != "ж��ж" {
+		t.Errorf("Строка: %q", L.Value)
+	}
+}
+
+func TestByteOrderMark(t *testing.T) {
+	L, E := NewBytesReader([]byte("\xEF\xBB\xBFА = 1")).BuildLexems()
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	if L.Type != ltIdent || (*L).LexemAsString() != "А" || L.ColumnNo != 0 ||
+		L.Offset != 3 {
+		t.Fatalf("Неправильная первая лексема: %d '%s'", L.Type, (*L).LexemAsString())
+	}
+	if L.Next.ColumnNo != 2 {
+		t.Errorf("Неправильная колонка: %d", L.Next.ColumnNo)
+	}
+
+	R := NewBytesReader([]byte("\xEF\xBB\xBF"))
+	R.UTF8Mode = UTF8Strict
+	if L, E = R.BuildLexems(); E != nil || L.Type != ltEOF {
+		t.Errorf("Текст из одного знака порядка байтов: %v", E)
+	}
+}
+
+func TestLegacyEncodings(t *testing.T) {
+	S := "Счётчик = \"Ёж\" // конец"
+	encoded := map[TEncoding][]byte{
+		EncodingWindows1251: {0xD1, 0xF7, 0xB8, 0xF2, 0xF7, 0xE8, 0xEA, ' ',
+			'=', ' ', '"', 0xA8, 0xE6, '"', ' ', '/', '/', ' ', 0xEA, 0xEE,
+			0xED, 0xE5, 0xF6},
+		EncodingKOI8R: {0xF3, 0xDE, 0xA3, 0xD4, 0xDE, 0xC9, 0xCB, ' ',
+			'=', ' ', '"', 0xB3, 0xD6, '"', ' ', '/', '/', ' ', 0xCB, 0xCF,
+			0xCE, 0xC5, 0xC3},
+		EncodingCP866: {0x91, 0xE7, 0xF1, 0xE2, 0xE7, 0xA8, 0xAA, ' ',
+			'=', ' ', '"', 0xF0, 0xA6, '"', ' ', '/', '/', ' ', 0xAA, 0xAE,
+			0xAD, 0xA5, 0xE6},
+	}
+
+	check := func(AName string, L PLexem, E error) {
+		if E != nil {
+			t.Errorf("%s: %s", AName, E.Error())
+			return
+		}
+		if L.Type == ltEOL {
+			// после прагмы
+			L = L.Next
+		}
+		if (*L).LexemAsString() != "Счётчик" {
+			t.Errorf("%s: первая лексема '%s'", AName, (*L).LexemAsString())
+		}
+		L = L.Next.Next
+		if L.Type != ltString || L.Value != "Ёж" || L.ColumnNo != 10 {
+			t.Errorf("%s: строка '%s' в колонке %d", AName, L.Value, L.ColumnNo)
+		}
+	}
+
+	for E, data := range encoded {
+		if string(DecodeText(data, E)) != S {
+			t.Errorf("Кодировка %d: неправильно перекодирован текст", E)
+		}
+		if D := DetectEncoding(data); D != E {
+			t.Errorf("Кодировка %d определена как %d", E, D)
+		}
+
+		R := NewBytesReader(data)
+		R.Encoding = E
+		L, err := R.BuildLexems()
+		check(fmt.Sprint("Кодировка ", E), L, err)
+
+		R = NewBytesReader(data)
+		R.Encoding = EncodingAuto
+		L, err = R.BuildLexems()
+		check(fmt.Sprint("Автоопределение ", E), L, err)
+	}
+
+	// прагма в первой строке
+	pragma := []byte("//# кодировка = KOI8-R\n")
+	data := append(pragma, encoded[EncodingKOI8R]...)
+	L, E := NewBytesReader(data).BuildLexems()
+	if E == nil && L.Next.LineNo != 1 {
+		t.Errorf("Прагма: первая лексема в строке %d", L.Next.LineNo)
+	}
+	check("Прагма", L, E)
+	if D := DetectEncoding(data); D != EncodingKOI8R {
+		t.Errorf("Прагма: кодировка определена как %d", D)
+	}
+
+	buf := []byte("//#encoding=cp866\n" + string(encoded[EncodingCP866]))
+	R := TReader{
+		Text: memfs.PBigByteArray(unsafe.Pointer(&buf[0])),
+		Size: uint64(len(buf)),
+	}
+	L, E = R.BuildLexems()
+	check("Прагма memfs", L, E)
+
+	_, E = NewBytesReader([]byte("//# encoding = latin-1\nА = 1")).BuildLexems()
+	if !errors.Is(E, EUnknownEncoding) {
+		t.Errorf("Ожидается ошибка EUnknownEncoding, получено: %v", E)
+	}
+}
+
+func TestLineEndings(t *testing.T) {
+	texts := []string{
+		"А = 1\r\n  Б = \"x\r\ny\"\r\n\r\nВ",
+		"А = 1\r  Б = \"x\ry\"\r\rВ",
+		"А = 1\n  Б = \"x\ny\"\n\nВ",
+	}
+
+	lexems := []struct {
+		Type             TLexemType
+		LineNo, ColumnNo uint
+	}{
+		{ltIdent, 0, 0},
+		{ltEqualSign, 0, 2},
+		{ltNumber, 0, 4},
+		{ltEOL, 0, 5},
+		{ltIdent, 1, 2},
+		{ltEqualSign, 1, 4},
+		{ltString, 1, 6},
+		{ltEOL, 2, 2},
+		{ltIdent, 4, 0},
+		{ltEOF, 4, 1},
+	}
+
+	for _, S := range texts {
+		L, E := NewBytesReader([]byte(S)).BuildLexems()
+		if E != nil {
+			t.Fatal(E.Error())
+		}
+		for i, N := range lexems {
+			if L.Type != N.Type || L.LineNo != N.LineNo || L.ColumnNo != N.ColumnNo {
+				t.Fatalf("%q: лексема %d: тип %d [%d:%d], ожидается %d [%d:%d]", S,
+					i, L.Type, L.LineNo, L.ColumnNo, N.Type, N.LineNo, N.ColumnNo)
+			}
+			if L.Type == ltString && L.Value != "x\ny" {
+				t.Errorf("%q: строка %q", S, L.Value)
+			}
+			L = L.Next
+		}
+	}
+
+	// ошибка после CR LF
+	_, E := stringToLexems("А = 1\r\n\r\n  Б = 0x")
+	if !errors.Is(E, EInvalidNumber) || E.(*lsaError).LineNo != 2 ||
+		E.(*lsaError).ColumnNo != 6 {
+		t.Errorf("Неправильная ошибка: %v", E)
+	}
+}
+
+func TestTabWidth(t *testing.T) {
+	S := "\tА\t= 1\n  \t\tБ"
+	columns := map[uint][]uint{
+		0: {1, 3, 5, 6, 4},
+		4: {4, 8, 10, 11, 8},
+		8: {8, 16, 18, 19, 16},
+	}
+
+	for width, standard := range columns {
+		R := NewBytesReader([]byte(S))
+		R.TabWidth = width
+		L, E := R.BuildLexems()
+		if E != nil {
+			t.Fatal(E.Error())
+		}
+		for i, C := range standard {
+			if L.ColumnNo != C {
+				t.Errorf("Ширина %d: лексема %d в колонке %d, ожидается %d",
+					width, i, L.ColumnNo, C)
+			}
+			L = L.Next
+		}
+	}
+}
+
+func TestLexemSpans(t *testing.T) {
+	pos := func(ALine, AColumn, AColumn16 uint, AOffset uint64) TPosition {
+		return TPosition{LineNo: ALine, ColumnNo: AColumn, Column16: AColumn16,
+			Offset: AOffset}
+	}
+	// Б = "😀x"␍␊В
+	spans := []struct {
+		Type TLexemType
+		Span TSpan
+	}{
+		{ltIdent, TSpan{pos(0, 0, 0, 0), pos(0, 1, 1, 2)}},
+		{ltEqualSign, TSpan{pos(0, 2, 2, 3), pos(0, 3, 3, 4)}},
+		{ltString, TSpan{pos(0, 4, 4, 5), pos(0, 8, 9, 12)}},
+		{ltEOL, TSpan{pos(0, 8, 9, 12), pos(1, 0, 0, 14)}},
+		{ltIdent, TSpan{pos(1, 0, 0, 14), pos(1, 1, 1, 16)}},
+	}
+
+	L, E := NewBytesReader([]byte("Б = \"😀x\"\r\nВ")).BuildLexems()
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	for i, S := range spans {
+		if L.Type != S.Type {
+			t.Fatalf("Лексема %d имеет тип %d, ожидается %d", i, L.Type, S.Type)
+		}
+		if L.Span != S.Span {
+			t.Errorf("Лексема %d: участок %+v, ожидается %+v", i, L.Span, S.Span)
+		}
+		L = L.Next
+	}
+
+	L, _ = NewBytesReader([]byte("А <= Б")).BuildLexems()
+	L = L.Next
+	if L.Span.End.ColumnNo != 4 || L.Span.End.Offset-L.Span.Start.Offset != 2 {
+		t.Errorf("Участок операции '<=': %+v", L.Span)
+	}
+}
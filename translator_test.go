@@ -1,19 +1,18 @@
 package lsa
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/biorhitm/memfs"
+	"io"
+	"math"
+	"strings"
+	"sync"
 	"testing"
-	"unsafe"
 )
 
 func stringToLexems(S string) (PLexem, error) {
-	buf, _ := stringToUTF8EncodedByteArray(S)
-	reader := TReader{
-		Text: memfs.PBigByteArray(unsafe.Pointer(&buf[0])),
-		Size: uint64(len(buf))}
-	return reader.BuildLexems()
+	return NewBytesReader([]byte(S)).BuildLexems()
 }
 
 // Структура для тестов, вместо номеров строк содержит текст
@@ -59,7 +58,7 @@ func compareLanguageItems(SD TSyntaxDescriptor,
 				S = SD.StrNumbers[idx]
 			}
 
-		case ltitString:
+		case ltitString, ltitChar:
 			{
 				S = SD.StrStrings[idx]
 			}
@@ -203,7 +202,7 @@ func TestTranslateFunctionDeclaration(t *testing.T) {
 	}
 
 	if E := compareStringAndLanguageItems(
-		"function F(А,Б: Int64): System.bool начало конец",
+		"function F(А,Б: Int64): System.bool начало вернуть А конец",
 		[]tLanguageItem{
 			{ltitFunction, ""}, {ltitIdent, "F"},
 			{ltitParameters, ""}, {ltitIdent, "А"}, {ltitIdent, "Б"},
@@ -211,33 +210,33 @@ func TestTranslateFunctionDeclaration(t *testing.T) {
 			{ltitDataType, ""},
 			{ltitPackageName, ""}, {ltitIdent, "System"},
 			{ltitIdent, "bool"},
-			{ltitBegin, ""}, {ltitEnd, ""},
+			{ltitBegin, ""}, {ltitReturn, ""}, {ltitIdent, "А"}, {ltitEnd, ""},
 		}); E != nil {
 		t.Fatal(E.Error())
 	}
 
 	if E := compareStringAndLanguageItems(
-		"func foo(): int переменные А, Б, В: Unicode Символ начало конец",
+		"func foo(): int переменные А, Б, В: Unicode Символ начало вернуть 0 конец",
 		[]tLanguageItem{
 			{ltitFunction, ""}, {ltitIdent, "foo"},
 			{ltitDataType, ""}, {ltitIdent, "int"},
 			{ltitVarList, ""},
 			{ltitIdent, "А"}, {ltitIdent, "Б"}, {ltitIdent, "В"},
 			{ltitDataType, ""}, {ltitIdent, "Unicode Символ"},
-			{ltitBegin, ""}, {ltitEnd, ""},
+			{ltitBegin, ""}, {ltitReturn, ""}, {ltitNumber, "0"}, {ltitEnd, ""},
 		}); E != nil {
 		t.Fatal(E.Error())
 	}
 
 	if E := compareStringAndLanguageItems(
-		"def foo: Тип функции foo var А, Б, В: Unicode Символ {}",
+		"def foo: Тип функции foo var А, Б, В: Unicode Символ { return А }",
 		[]tLanguageItem{
 			{ltitFunction, ""}, {ltitIdent, "foo"},
 			{ltitDataType, ""}, {ltitIdent, "Тип функции foo"},
 			{ltitVarList, ""},
 			{ltitIdent, "А"}, {ltitIdent, "Б"}, {ltitIdent, "В"},
 			{ltitDataType, ""}, {ltitIdent, "Unicode Символ"},
-			{ltitBegin, ""}, {ltitEnd, ""},
+			{ltitBegin, ""}, {ltitReturn, ""}, {ltitIdent, "А"}, {ltitEnd, ""},
 		}); E != nil {
 		t.Fatal(E.Error())
 	}
@@ -245,14 +244,14 @@ func TestTranslateFunctionDeclaration(t *testing.T) {
 
 func TestTranslateCode(t *testing.T) {
 	if E := compareStringAndLanguageItems(
-		"def foo: Тип функции foo var А, Б, В: Unicode Символ {}",
+		"def foo: Тип функции foo var А, Б, В: Unicode Символ { return А }",
 		[]tLanguageItem{
 			{ltitFunction, ""}, {ltitIdent, "foo"},
 			{ltitDataType, ""}, {ltitIdent, "Тип функции foo"},
 			{ltitVarList, ""},
 			{ltitIdent, "А"}, {ltitIdent, "Б"}, {ltitIdent, "В"},
 			{ltitDataType, ""}, {ltitIdent, "Unicode Символ"},
-			{ltitBegin, ""}, {ltitEnd, ""},
+			{ltitBegin, ""}, {ltitReturn, ""}, {ltitIdent, "А"}, {ltitEnd, ""},
 		}); E != nil {
 		t.Fatal(E.Error())
 	}
@@ -383,3 +382,1292 @@ func TestOperations(t *testing.T) {
 		t.Fatal(E.Error())
 	}
 }
+
+// Записывает синтаксическое дерево в виде списка в скобках,
+// для упрощения сравнения деревьев в тестах
+func nodeToString(N TNode) string {
+	list := func(AHead string, AItems ...string) string {
+		return "(" + strings.Join(append([]string{AHead}, AItems...), " ") + ")"
+	}
+	typeToString := func(T *TTypeRef) string {
+		if T.Package != nil {
+			return T.Package.Name + "." + T.Name.Name
+		}
+		return T.Name.Name
+	}
+	specsToString := func(ASpecs []*TVarSpec) []string {
+		res := make([]string, 0, len(ASpecs))
+		for _, spec := range ASpecs {
+			S := make([]string, 0, len(spec.Names))
+			for _, name := range spec.Names {
+				S = append(S, name.Name)
+			}
+			res = append(res, "("+strings.Join(S, ",")+" "+
+				typeToString(spec.Type)+")")
+		}
+		return res
+	}
+	stmtsToString := func(AList []TStmt) []string {
+		res := make([]string, 0, len(AList))
+		for _, S := range AList {
+			res = append(res, nodeToString(S))
+		}
+		return res
+	}
+
+	switch X := N.(type) {
+	case *TIdent:
+		return X.Name
+	case *TLiteral:
+		if X.Kind == ltitString {
+			return "\"" + X.Value + "\""
+		}
+		return X.Value
+	case *TUnaryExpr:
+		return list(fmt.Sprint(X.Op), nodeToString(X.X))
+	case *TBinaryExpr:
+		return list(fmt.Sprint(X.Op), nodeToString(X.X), nodeToString(X.Y))
+	case *TCallExpr:
+		name := X.Func.Name
+		if X.Object != nil {
+			name = X.Object.Name + "." + name
+		}
+		args := make([]string, 0, len(X.Args))
+		for _, A := range X.Args {
+			args = append(args, nodeToString(A))
+		}
+		return list("call", append([]string{name}, args...)...)
+	case *TCallStmt:
+		return nodeToString(X.Call)
+	case *TAssignStmt:
+		return list("=", nodeToString(X.Target), nodeToString(X.Value))
+	case *TVarDecl:
+		return list("var", specsToString(X.Specs)...)
+	case *TBlockStmt:
+		return list("block", stmtsToString(X.List)...)
+	case *TIfStmt:
+		if X.Else != nil {
+			return list("if", nodeToString(X.Cond), nodeToString(X.Then),
+				nodeToString(X.Else))
+		}
+		return list("if", nodeToString(X.Cond), nodeToString(X.Then))
+	case *TWhileStmt:
+		return list("while", nodeToString(X.Cond), nodeToString(X.Body))
+	case *TReturnStmt:
+		if X.Result != nil {
+			return list("return", nodeToString(X.Result))
+		}
+		return list("return")
+	case *TForStmt:
+		head := "for"
+		if X.Down {
+			head = "for-down"
+		}
+		items := []string{nodeToString(X.Var), nodeToString(X.From),
+			nodeToString(X.To)}
+		if X.Step != nil {
+			items = append(items, list("step", nodeToString(X.Step)))
+		}
+		return list(head, append(items, nodeToString(X.Body))...)
+	case *TRepeatStmt:
+		head := "do-while"
+		if X.Until {
+			head = "repeat-until"
+		}
+		return list(head, nodeToString(X.Body), nodeToString(X.Cond))
+	case *TFuncDecl:
+		name := X.Name.Name
+		if X.Class != nil {
+			name = X.Class.Name + "." + name
+		}
+		items := []string{name, list("params", specsToString(X.Params)...)}
+		if X.Result != nil {
+			items = append(items, typeToString(X.Result))
+		}
+		if X.Vars != nil {
+			items = append(items, nodeToString(X.Vars))
+		}
+		head := "func"
+		if X.Procedure {
+			head = "proc"
+		}
+		return list(head, append(items, nodeToString(X.Body))...)
+	case *TProgram:
+		return list("program", stmtsToString(X.List)...)
+	}
+	return fmt.Sprintf("<%T>", N)
+}
+
+func stringToTree(AText string) (*TProgram, error) {
+	lexems, E := stringToLexems(AText)
+	if E != nil {
+		return nil, E
+	}
+	sd, E := TranslateCode(lexems)
+	if E != nil {
+		return nil, E
+	}
+	return sd.Program, nil
+}
+
+func compareStringAndTree(AText, AStandard string) error {
+	P, E := stringToTree(AText)
+	if E != nil {
+		return E
+	}
+	if S := nodeToString(P); S != AStandard {
+		return fmt.Errorf("Получено дерево:\n%s\nожидается:\n%s", S, AStandard)
+	}
+	return nil
+}
+
+func TestSyntaxTree(t *testing.T) {
+	add := fmt.Sprint(ltitMathAdd)
+	mul := fmt.Sprint(ltitMathMul)
+	above := fmt.Sprint(ltitAbove)
+	below := fmt.Sprint(ltitBelow)
+	not := fmt.Sprint(ltitNOT)
+
+	if E := compareStringAndTree(
+		"функция Класс.F(А, Б: целый, В: пакет.Тип): целый\n"+
+			"переменные Г: целый\n"+
+			"начало\n"+
+			"  если А > 1 Г = А * 2 + 1\n"+
+			"  иначе пока не Б < 3 Б = Б + (1 + Г) * 2\n"+
+			"  вернуть Г\n"+
+			"конец\n"+
+			"var Икс: строка\n"+
+			"Икс = \"Привет\"",
+		"(program "+
+			"(func Класс.F (params (А,Б целый) (В пакет.Тип)) целый "+
+			"(var (Г целый)) "+
+			"(block (if ("+above+" А 1) (= Г ("+add+" ("+mul+" А 2) 1)) "+
+			"(while ("+below+" ("+not+" Б) 3) "+
+			"(= Б ("+add+" Б ("+mul+" ("+add+" 1 Г) 2))))) (return Г))) "+
+			"(var (Икс строка)) "+
+			"(= Икс \"Привет\"))"); E != nil {
+		t.Fatal(E.Error())
+	}
+}
+
+func TestSyntaxTreePositions(t *testing.T) {
+	lexems, E := stringToLexems("если А = 1\n  Б = Б + 42")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	sd, E := TranslateCode(lexems)
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	I := sd.Program.List[0].(*TIfStmt)
+	A := I.Then.(*TAssignStmt)
+	Y := A.Value.(*TBinaryExpr).Y
+
+	positions := []struct {
+		N                TNode
+		LineNo, ColumnNo uint
+	}{
+		{I, 0, 0}, {I.Cond, 0, 5}, {A, 1, 2}, {A.Target, 1, 2},
+		{A.Value, 1, 6}, {Y, 1, 10},
+	}
+	for i, P := range positions {
+		pos := P.N.Position()
+		if pos.LineNo != P.LineNo || pos.ColumnNo != P.ColumnNo {
+			t.Errorf("Узел № %d находится в [%d:%d], ожидается [%d:%d]",
+				i, pos.LineNo, pos.ColumnNo, P.LineNo, P.ColumnNo)
+		}
+	}
+}
+
+func TestOperationPriority(t *testing.T) {
+	add := fmt.Sprint(ltitMathAdd)
+	sub := fmt.Sprint(ltitMathSub)
+	mul := fmt.Sprint(ltitMathMul)
+	div := fmt.Sprint(ltitMathDiv)
+	shl := fmt.Sprint(ltitLeftShift)
+	eq := fmt.Sprint(ltitEqual)
+	ne := fmt.Sprint(ltitNotEqual)
+	not := fmt.Sprint(ltitNOT)
+
+	tests := []struct{ Text, Tree string }{
+		{"A = B + C * D",
+			"(program (= A (" + add + " B (" + mul + " C D))))"},
+		{"A = B * C + D",
+			"(program (= A (" + add + " (" + mul + " B C) D)))"},
+		{"A = B - C - D",
+			"(program (= A (" + sub + " (" + sub + " B C) D)))"},
+		{"A = B / C * D",
+			"(program (= A (" + mul + " (" + div + " B C) D)))"},
+		{"A = (B + C) * D",
+			"(program (= A (" + mul + " (" + add + " B C) D)))"},
+		{"A = B << 1 + 2 = C <> D",
+			"(program (= A (" + ne + " (" + eq + " (" + shl + " B (" + add +
+				" 1 2)) C) D)))"},
+		{"A = не B * C",
+			"(program (= A (" + mul + " (" + not + " B) C)))"},
+		{"A = не (B + C)",
+			"(program (= A (" + not + " (" + add + " B C))))"},
+		{"A = ((B))",
+			"(program (= A B))"},
+	}
+
+	for _, T := range tests {
+		if E := compareStringAndTree(T.Text, T.Tree); E != nil {
+			t.Errorf("%s: %s", T.Text, E.Error())
+		}
+	}
+}
+
+func TestLogicalOperations(t *testing.T) {
+	op := func(AType TLanguageItemType) string {
+		return fmt.Sprint(AType)
+	}
+	and, or, xor := op(ltitAND), op(ltitOR), op(ltitXOR)
+	add, mul, mod := op(ltitMathAdd), op(ltitMathMul), op(ltitModulo)
+	bitAnd, bitOr, bitXor := op(ltitBitAND), op(ltitBitOR), op(ltitBitXOR)
+	below, above, eq := op(ltitBelow), op(ltitAbove), op(ltitEqual)
+	pow, shl, shr := op(ltitInvolution), op(ltitLeftShift), op(ltitRightShift)
+	not, addr := op(ltitNOT), op(ltitAddressOf)
+
+	tests := []struct{ Text, Tree string }{
+		{"A = B < 1 или C > 2 и не D",
+			"(program (= A (" + or + " (" + below + " B 1) (" + and + " (" +
+				above + " C 2) (" + not + " D)))))"},
+		{"A = B or C xor D and E",
+			"(program (= A (" + or + " B (" + xor + " C (" + and + " D E)))))"},
+		{"A = B || C && D",
+			"(program (= A (" + or + " B (" + and + " C D))))"},
+		{"A = B искл C = D",
+			"(program (= A (" + xor + " B (" + eq + " C D))))"},
+		{"A = B + C & 7",
+			"(program (= A (" + add + " B (" + bitAnd + " C 7))))"},
+		{"A = B | C ~ D * E",
+			"(program (= A (" + bitXor + " (" + bitOr + " B C) (" + mul +
+				" D E))))"},
+		{"A = B % 2 ^ C ^ 3",
+			"(program (= A (" + mod + " B (" + pow + " 2 (" + pow + " C 3)))))"},
+		{"A = B сдвл 2 shr C",
+			"(program (= A (" + shr + " (" + shl + " B 2) C)))"},
+		// & перед операндом — взятие адреса, после — поразрядное И
+		{"A = &B & &C",
+			"(program (= A (" + bitAnd + " (" + addr + " B) (" + addr + " C))))"},
+		{"если A и B начало C = 1 конец",
+			"(program (if (" + and + " A B) (block (= C 1))))"},
+		// операция словом стоит после операнда, а на месте операнда это имя
+		{"и = 5\nили = и и или",
+			"(program (= и 5) (= или (" + and + " и или)))"},
+		{"для и от 1 до 2 {}", "(program (for и 1 2 (block)))"},
+		{"переменные и, shl: целый", "(program (var (и,shl целый)))"},
+		{"A = Длина и ширина",
+			"(program (= A (" + and + " Длина ширина)))"},
+	}
+	for _, T := range tests {
+		if E := compareStringAndTree(T.Text, T.Tree); E != nil {
+			t.Errorf("%s: %s", T.Text, E.Error())
+		}
+	}
+
+	if _, E := stringToTree("A = B и"); !errors.Is(E, EExpectedArgument) {
+		t.Errorf("Ожидается ошибка EExpectedArgument, получено: %v", E)
+	}
+	// после первого слова имени 'и' — операция, поэтому имя не может
+	// содержать 'и'
+	_, E := stringToTree("Длина и ширина = 1")
+	if !errors.Is(E, ESyntaxError) || E.(*lsaError).ColumnNo != 6 {
+		t.Errorf("Ожидается ошибка ESyntaxError в колонке 6, получено: %v", E)
+	}
+}
+
+func TestUnaryOperations(t *testing.T) {
+	op := func(AType TLanguageItemType) string {
+		return fmt.Sprint(AType)
+	}
+	neg, plus, bitNot := op(ltitNegate), op(ltitUnaryPlus), op(ltitBitNOT)
+	add, sub, mul := op(ltitMathAdd), op(ltitMathSub), op(ltitMathMul)
+	pow, xor := op(ltitInvolution), op(ltitBitXOR)
+
+	tests := []struct{ Text, Tree string }{
+		{"Икс = -5", "(program (= Икс -5))"},
+		{"Икс = +5", "(program (= Икс 5))"},
+		{"Икс = -(5)", "(program (= Икс -5))"},
+		{"Икс = - -2.5", "(program (= Икс 2.5))"},
+		{"Икс = -(А + Б)",
+			"(program (= Икс (" + neg + " (" + add + " А Б))))"},
+		{"Икс = +А", "(program (= Икс (" + plus + " А)))"},
+		{"Икс = -А * Б - -1",
+			"(program (= Икс (" + sub + " (" + mul + " (" + neg + " А) Б) -1)))"},
+		{"Икс = -А ^ 2",
+			"(program (= Икс (" + neg + " (" + pow + " А 2))))"},
+		{"Икс = -2 ^ 2",
+			"(program (= Икс (" + neg + " (" + pow + " 2 2))))"},
+		{"Икс = 2 ^ -1", "(program (= Икс (" + pow + " 2 -1)))"},
+		{"Икс = ~А ~ ~0",
+			"(program (= Икс (" + xor + " (" + bitNot + " А) (" + bitNot +
+				" 0))))"},
+		{"Икс = -9223372036854775808", "(program (= Икс -9223372036854775808))"},
+	}
+	for _, T := range tests {
+		if E := compareStringAndTree(T.Text, T.Tree); E != nil {
+			t.Errorf("%s: %s", T.Text, E.Error())
+		}
+	}
+
+	P, E := stringToTree("Икс = -5")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	X := P.List[0].(*TAssignStmt).Value.(*TLiteral)
+	if X.Number.Int != -5 || X.Span() != (TSpan{TPosition{0, 6, 6, 9},
+		TPosition{0, 8, 8, 11}}) {
+		t.Errorf("Константа: %+v", X)
+	}
+
+	N := TNumberValue{Int: math.MinInt64}.Neg()
+	if N.Big == nil || N.String() != "9223372036854775808" ||
+		N.Neg().Big != nil || N.Neg().Int != math.MinInt64 {
+		t.Errorf("Neg: %v", N)
+	}
+}
+
+func TestReturnStatement(t *testing.T) {
+	mul := fmt.Sprint(ltitMathMul)
+	tests := []struct{ Text, Tree string }{
+		{"функция Ф(А: целый): целый начало вернуть А * 2 конец",
+			"(program (func Ф (params (А целый)) целый (block (return (" + mul +
+				" А 2)))))"},
+		{"процедура П начало если А вернуть иначе вернуть\n Б = 1 конец",
+			"(program (proc П (params) (block (if А (return) (return)) " +
+				"(= Б 1))))"},
+		{"function F(): int {\n  result = 1\n  return }",
+			"(program (func F (params) int (block (= result 1) (return))))"},
+	}
+	for _, T := range tests {
+		if E := compareStringAndTree(T.Text, T.Tree); E != nil {
+			t.Errorf("%s: %s", T.Text, E.Error())
+		}
+	}
+
+	errs := []struct {
+		Text  string
+		Error *lsaError
+		Line  uint
+		Col   uint
+	}{
+		{"А = 1\nвернуть А", EReturnOutsideFunction, 1, 0},
+		{"процедура П начало\n  вернуть 1 + 2\nконец", EProcedureReturnsValue, 1, 10},
+		{"функция Ф начало вернуть 1 конец", EProcedureReturnsValue, 0, 25},
+		{"процедура П(): целый начало конец", EProcedureResult, 0, 15},
+	}
+	for _, T := range errs {
+		_, E := stringToTree(T.Text)
+		if !errors.Is(E, T.Error) || E.(*lsaError).LineNo != T.Line ||
+			E.(*lsaError).ColumnNo != T.Col {
+			t.Errorf("%q: ожидается ошибка %v в [%d:%d], получено: %v", T.Text,
+				T.Error.Msg, T.Line, T.Col, E)
+		}
+	}
+
+	// значение в процедуре выделяется целиком
+	_, E := stringToTree("процедура П начало вернуть 1 + 2 конец")
+	if D := DiagnosticOf(E); D.Span.End.ColumnNo != 32 {
+		t.Errorf("Участок ошибки: %+v", D.Span)
+	}
+
+	// функция с результатом должна вернуть значение на всех путях; ошибка
+	// записывается, а функция остаётся в дереве
+	missing := []string{
+		"функция Ф: целый начало если А > 0 начало вернуть 1 конец конец",
+		"функция Ф(А: целый): целый начало если А вернуть 1 конец",
+		"функция Ф(А: целый): целый начало пока А вернуть 1 конец",
+		"функция Ф(А: целый): целый начало если А вернуть 1 иначе вернуть конец",
+		"функция Ф: целый начало конец",
+		// тело цикла может не выполниться ни разу
+		"функция Ф(Н: целый): целый начало для И от 1 до Н вернуть И конец",
+	}
+	for _, text := range missing {
+		lexems, E := stringToLexems(text)
+		if E != nil {
+			t.Fatal(E.Error())
+		}
+		sd, E := TranslateCode(lexems)
+		if !errors.Is(E, EMissingReturn) || E.(*lsaError).ColumnNo != 8 ||
+			len(sd.Diagnostics) != 1 || len(sd.Program.List) != 1 {
+			t.Errorf("%q: ожидается ошибка EMissingReturn, получено: %v", text,
+				sd.Diagnostics)
+		}
+	}
+	// тело цикла 'повторять' выполняется хотя бы один раз
+	if _, E := stringToTree("функция Ф: целый начало повторять\n" +
+		"  вернуть 1\nдо 1 конец"); E != nil {
+		t.Error(E.Error())
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	add := fmt.Sprint(ltitMathAdd)
+	tests := []struct{ Text, Tree string }{
+		{"для И от 1 до 10 шаг 2 начало С = С + И конец",
+			"(program (for И 1 10 (step 2) (block (= С (" + add + " С И)))))"},
+		{"for i = 1 to N + 1 begin end",
+			"(program (for i 1 (" + add + " N 1) (block)))"},
+		{"для Номер строки := 10 вниз до 1 Печать(Номер строки)",
+			"(program (for-down Номер строки 10 1 (call Печать Номер строки)))"},
+		{"for i from N downto 0 step 0.5 { }",
+			"(program (for-down i N 0 (step 0.5) (block)))"},
+		// слова заголовка зарезервированы только в заголовке цикла
+		{"Расстояние до цели = 5\nшаг = от края",
+			"(program (= Расстояние до цели 5) (= шаг от края))"},
+		{"для К от Начало отсчёта до Длина пути шаг Шаг\n  Путь от дома = К",
+			"(program (for К Начало отсчёта Длина пути (step Шаг) " +
+				"(= Путь от дома К)))"},
+		{"для К от 1 до 2 начало Расстояние до цели = К конец",
+			"(program (for К 1 2 (block (= Расстояние до цели К))))"},
+	}
+	for _, T := range tests {
+		if E := compareStringAndTree(T.Text, T.Tree); E != nil {
+			t.Errorf("%s: %s", T.Text, E.Error())
+		}
+	}
+
+	if E := compareStringAndLanguageItems("для И от 1 вниз до 0 шаг 1 {}",
+		[]tLanguageItem{
+			{ltitFor, ""}, {ltitIdent, "И"}, {ltitAssignment, ""},
+			{ltitNumber, "1"}, {ltitDownTo, ""}, {ltitNumber, "0"},
+			{ltitStep, ""}, {ltitNumber, "1"}, {ltitBegin, ""}, {ltitEnd, ""},
+		}); E != nil {
+		t.Error(E.Error())
+	}
+
+	errs := []struct {
+		Text  string
+		Error *lsaError
+		Col   uint
+	}{
+		{"для от 1 до 2 {}", EExpectedVarName, 4},
+		{"для И 1 до 2 {}", EExpectedFrom, 6},
+		{"для И от 1 2 {}", EExpectedTo, 11},
+		{"для И от 2 вниз 1 {}", EExpectedTo, 16},
+		{"для И от 1 до 2 шаг -1 {}", ENonPositiveStep, 20},
+		{"for i = 1 to 2 step 0 {}", ENonPositiveStep, 20},
+		// без 'начало' имя переменной входит в границу цикла
+		{"для И от 1 до Н С += И", EExpectedVarName, 18},
+		{"функция Ф начало для И от 1 до Н С += И конец", EExpectedVarName, 35},
+	}
+	for _, T := range errs {
+		_, E := stringToTree(T.Text)
+		if !errors.Is(E, T.Error) || E.(*lsaError).ColumnNo != T.Col {
+			t.Errorf("%q: ожидается ошибка %v в колонке %d, получено: %v",
+				T.Text, T.Error.Msg, T.Col, E)
+		}
+	}
+
+	// отрицательный шаг: сообщение подсказывает 'вниз до'
+	_, E := stringToTree("для И от 9 до 0 шаг -1 {}")
+	if !strings.Contains(ErrorMessage(E, LanguageRussian), "'вниз до'") ||
+		!strings.Contains(ErrorMessage(E, LanguageEnglish), "'downto'") {
+		t.Errorf("Нет подсказки 'вниз до': %v", E)
+	}
+}
+
+func TestRepeatStatement(t *testing.T) {
+	add := fmt.Sprint(ltitMathAdd)
+	above := fmt.Sprint(ltitAbove)
+	tests := []struct{ Text, Tree string }{
+		{"повторять\n  А = А + 1\n  Печать(А)\nдо А > 10",
+			"(program (repeat-until (block (= А (" + add + " А 1)) " +
+				"(call Печать А)) (" + above + " А 10)))"},
+		{"repeat begin A = A + 1 end until A > 10",
+			"(program (repeat-until (block (= A (" + add + " A 1))) (" +
+				above + " A 10)))"},
+		{"повторять начало А = 1 конец\nБ = 2\nдо Готово",
+			"(program (repeat-until (block (block (= А 1)) (= Б 2)) Готово))"},
+		{"повторять начало Шаг() конец пока Не готово",
+			"(program (do-while (block (call Шаг)) Не готово))"},
+		{"do { A = A + 1 } while A > 10",
+			"(program (do-while (block (= A (" + add + " A 1))) (" + above +
+				" A 10)))"},
+		{"повторять А = Б до А > 5",
+			"(program (repeat-until (block (= А Б)) (" + above + " А 5)))"},
+		{"повторять начало Расстояние до цели = 1 конец до Х",
+			"(program (repeat-until (block (= Расстояние до цели 1)) Х))"},
+		// вне цикла слова цикла — обычные имена
+		{"do = 1\nuntil = do + 1\nЧто повторять = until",
+			"(program (= do 1) (= until (" + add + " do 1)) " +
+				"(= Что повторять until))"},
+		// 'пока' в теле без программных скобок начинает вложенный цикл
+		{"повторять\n  пока А > 0\n    А = А - 1\nдо Б",
+			"(program (repeat-until (block (while (" + above + " А 0) (= А (" +
+				fmt.Sprint(ltitMathSub) + " А 1)))) Б))"},
+	}
+	for _, T := range tests {
+		if E := compareStringAndTree(T.Text, T.Tree); E != nil {
+			t.Errorf("%s: %s", T.Text, E.Error())
+		}
+	}
+
+	if E := compareStringAndLanguageItems("повторять {} пока 1",
+		[]tLanguageItem{
+			{ltitRepeat, ""}, {ltitBegin, ""}, {ltitEnd, ""}, {ltitWhile, ""},
+			{ltitNumber, "1"},
+		}); E != nil {
+		t.Error(E.Error())
+	}
+	if E := compareStringAndLanguageItems("repeat\nuntil 1",
+		[]tLanguageItem{{ltitRepeat, ""}, {ltitUntil, ""}, {ltitNumber, "1"}},
+	); E != nil {
+		t.Error(E.Error())
+	}
+
+	errs := []struct {
+		Text string
+		Line uint
+		Col  uint
+	}{
+		{"повторять\n  А = 1\n", 2, 0},
+		{"начало повторять А = 1 конец", 0, 23},
+		{"repeat { A = 1 } B = 2", 0, 22},
+	}
+	for _, T := range errs {
+		_, E := stringToTree(T.Text)
+		if !errors.Is(E, EExpectedUntil) || E.(*lsaError).LineNo != T.Line ||
+			E.(*lsaError).ColumnNo != T.Col {
+			t.Errorf("%q: ожидается ошибка %v в %d:%d, получено: %v",
+				T.Text, EExpectedUntil.Msg, T.Line, T.Col, E)
+		}
+	}
+
+	// условие 'пока' после тела без программных скобок
+	whiles := []struct {
+		Text string
+		Line uint
+		Col  uint
+	}{
+		{"do x = 1 while x < 10", 0, 9},
+		{"повторять Икс = 1 пока Икс < 10\nА = 1", 0, 18},
+		{"начало\n  повторять\n    Икс = 1\n  пока Икс < 10\nконец", 3, 2},
+		{"повторять\n  пока А > 0\n    для К от 1 до 2 {}\nБ = 1", 1, 2},
+	}
+	for _, T := range whiles {
+		lexems, E := stringToLexems(T.Text)
+		if E != nil {
+			t.Fatal(E.Error())
+		}
+		sd, _ := TranslateCode(lexems)
+		if len(sd.Diagnostics) != 1 || sd.Diagnostics[0].Code != EWhileNeedsBlock.Code ||
+			sd.Diagnostics[0].Span.Start.LineNo != T.Line ||
+			sd.Diagnostics[0].Span.Start.ColumnNo != T.Col {
+			t.Errorf("%q: ожидается одна ошибка %s в %d:%d, получено: %v",
+				T.Text, EWhileNeedsBlock.Code, T.Line, T.Col, sd.Diagnostics)
+		}
+	}
+}
+
+func TestParenthesisErrors(t *testing.T) {
+	if _, E := stringToTree("A = (B + (C)"); !errors.Is(E, ETooMuchOpenRB) {
+		t.Errorf("Ожидается ошибка ETooMuchOpenRB, получено: %v", E)
+	}
+	if _, E := stringToTree("A = B + C)"); !errors.Is(E, ETooMuchCloseRB) {
+		t.Errorf("Ожидается ошибка ETooMuchCloseRB, получено: %v", E)
+	}
+	if _, E := stringToTree("A = B + "); !errors.Is(E, EExpectedArgument) {
+		t.Errorf("Ожидается ошибка EExpectedArgument, получено: %v", E)
+	}
+}
+
+func TestCallExpression(t *testing.T) {
+	add := fmt.Sprint(ltitMathAdd)
+	mul := fmt.Sprint(ltitMathMul)
+
+	tests := []struct{ Text, Tree string }{
+		{"Икс = синус(угол)",
+			"(program (= Икс (call синус угол)))"},
+		{"Икс = среднее арифметическое(А, Б + 1) * 2",
+			"(program (= Икс (" + mul + " (call среднее арифметическое А (" +
+				add + " Б 1)) 2)))"},
+		{"Икс = F(G(), H(1, \"а\"))",
+			"(program (= Икс (call F (call G) (call H 1 \"а\"))))"},
+		{"Икс = Мой объект.Длина(А,\n Б) + F()",
+			"(program (= Икс (" + add + " (call Мой объект.Длина А Б) " +
+				"(call F))))"},
+		{"печать(А)\nОкно.Показать()\nесли Готово(А) начало Сброс() конец",
+			"(program (call печать А) (call Окно.Показать) " +
+				"(if (call Готово А) (block (call Сброс))))"},
+	}
+
+	for _, T := range tests {
+		if E := compareStringAndTree(T.Text, T.Tree); E != nil {
+			t.Errorf("%s: %s", T.Text, E.Error())
+		}
+	}
+
+	if E := compareStringAndLanguageItems(
+		"Объект.Метод(1, синус(Б))",
+		[]tLanguageItem{
+			{ltitCall, ""}, {ltitClassMember, ""}, {ltitIdent, "Объект"},
+			{ltitIdent, "Метод"}, {ltitOpenParenthesis, ""},
+			{ltitNumber, "1"}, {ltitComma, ""},
+			{ltitCall, ""}, {ltitIdent, "синус"}, {ltitOpenParenthesis, ""},
+			{ltitIdent, "Б"}, {ltitCloseParenthesis, ""},
+			{ltitCloseParenthesis, ""},
+		}); E != nil {
+		t.Fatal(E.Error())
+	}
+
+	if _, E := stringToTree("Икс = F(А, Б"); !errors.Is(E, ETooMuchOpenRB) {
+		t.Errorf("Ожидается ошибка ETooMuchOpenRB, получено: %v", E)
+	}
+}
+
+func TestNumberValues(t *testing.T) {
+	L, E := stringToLexems("А = 0x10 + 16 + 1.5e1 + 15.0")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	SD, E := TranslateCode(L)
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	standard := []string{"16", "15.0"}
+	if len(SD.StrNumbers) != len(standard) || len(SD.Numbers) != len(standard) {
+		t.Fatalf("Неправильный список чисел: %v", SD.StrNumbers)
+	}
+	for i, S := range standard {
+		if SD.StrNumbers[i] != S || SD.Numbers[i].String() != S {
+			t.Errorf("Число %d: %s, ожидается %s", i, SD.StrNumbers[i], S)
+		}
+	}
+	if SD.Numbers[0].IsFloat || SD.Numbers[0].Int != 16 ||
+		!SD.Numbers[1].IsFloat || SD.Numbers[1].Float != 15 {
+		t.Errorf("Неправильные значения чисел: %v", SD.Numbers)
+	}
+}
+
+func TestTranslateComments(t *testing.T) {
+	above := fmt.Sprint(ltitAbove)
+	div := fmt.Sprint(ltitMathDiv)
+
+	if E := compareStringAndTree(
+		"// начало программы\n"+
+			"если А > 1 { /* первый\n оператор */ Б = А / 2 } // конец",
+		"(program (if ("+above+" А 1) (block (= Б ("+div+" А 2)))))"); E != nil {
+		t.Fatal(E.Error())
+	}
+
+	// строки из одного комментария не отличаются от пустых строк
+	tests := []struct{ Text, Tree string }{
+		{"если А > Б\n// к\nначало В = 1 конец",
+			"(program (if (" + above + " А Б) (block (= В 1))))"},
+		{"если А > Б начало В = 1 конец\n// к\nиначе\n  /* к */\nВ = 2",
+			"(program (if (" + above + " А Б) (block (= В 1)) (= В 2)))"},
+		{"функция Ф\n// к1\n// к2\nначало\n// к3\n\n  // к4\nконец",
+			"(program (func Ф (params) (block)))"},
+	}
+	for _, T := range tests {
+		if E := compareStringAndTree(T.Text, T.Tree); E != nil {
+			t.Errorf("%q: %s", T.Text, E.Error())
+		}
+	}
+}
+
+func TestTwoCharOperations(t *testing.T) {
+	if E := compareStringAndLanguageItems(
+		"A := B == C != D ** 2",
+		[]tLanguageItem{
+			{ltitIdent, "A"}, {ltitAssignment, ""},
+			{ltitIdent, "B"}, {ltitEqual, ""}, {ltitIdent, "C"},
+			{ltitNotEqual, ""}, {ltitIdent, "D"}, {ltitInvolution, ""},
+			{ltitNumber, "2"},
+		}); E != nil {
+		t.Fatal(E.Error())
+	}
+	if E := compareStringAndLanguageItems(
+		"A *= B + 1",
+		[]tLanguageItem{
+			{ltitIdent, "A"}, {ltitAssignment, ""},
+			{ltitIdent, "A"}, {ltitMathMul, ""}, {ltitOpenParenthesis, ""},
+			{ltitIdent, "B"}, {ltitMathAdd, ""}, {ltitNumber, "1"},
+			{ltitCloseParenthesis, ""},
+		}); E != nil {
+		t.Fatal(E.Error())
+	}
+
+	mul := fmt.Sprint(ltitMathMul)
+	add := fmt.Sprint(ltitMathAdd)
+	if E := compareStringAndTree("A *= B + 1",
+		"(program (= A ("+mul+" A ("+add+" B 1))))"); E != nil {
+		t.Fatal(E.Error())
+	}
+
+	// знаки операции должны идти подряд
+	if _, E := stringToTree("A = B > = C"); !errors.Is(E, EExpectedArgument) {
+		t.Errorf("Ожидается ошибка EExpectedArgument, получено: %v", E)
+	}
+	if _, E := stringToTree("A = B < > C"); !errors.Is(E, EExpectedArgument) {
+		t.Errorf("Ожидается ошибка EExpectedArgument, получено: %v", E)
+	}
+}
+
+func TestTranslateReader(t *testing.T) {
+	S := "функция Квадрат(Х: двойной): двойной начало вернуть Х * Х конец\n" +
+		"переменные А: целый\n\n" +
+		"если А > 1 { А = Квадрат(А) } // конец\n"
+
+	L, E := stringToLexems(S)
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	standard, E := TranslateCode(L)
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	SD, E := TranslateReader(NewBytesReader([]byte(S)))
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	if A, B := nodeToString(SD.Program), nodeToString(standard.Program); A != B {
+		t.Fatalf("Получено дерево:\n%s\nожидается:\n%s", A, B)
+	}
+	// первая лексема и лексемы пройденного присваивания не удерживаются
+	if SD.StartLexem != nil {
+		t.Errorf("Удерживается лексема '%s'", SD.StartLexem.LexemAsString())
+	}
+	if len(SD.LanguageItems) != len(standard.LanguageItems) {
+		t.Fatalf("Получено %d элементов, ожидается %d",
+			len(SD.LanguageItems), len(standard.LanguageItems))
+	}
+	for i, item := range standard.LanguageItems {
+		if SD.LanguageItems[i] != item {
+			t.Fatalf("Элемент %d: %v, ожидается %v", i, SD.LanguageItems[i], item)
+		}
+	}
+
+	// ошибка чтения лексем
+	_, E = TranslateReader(NewBytesReader([]byte("А = 1\nБ = \"строка")))
+	if !errors.Is(E, EUnterminatedString) {
+		t.Errorf("Ожидается ошибка EUnterminatedString, получено: %v", E)
+	}
+
+	// перевод продолжается после синтаксической ошибки до ошибки чтения,
+	// возвращается первая ошибка
+	SD, E = TranslateReader(NewBytesReader([]byte("А = (1\nБ = \"строка")))
+	if !errors.Is(E, ETooMuchOpenRB) {
+		t.Errorf("Ожидается ошибка ETooMuchOpenRB, получено: %v", E)
+	}
+	if len(SD.Diagnostics) != 2 || SD.Diagnostics[1].Code != EUnterminatedString.Code {
+		t.Errorf("Ожидается две ошибки, получено: %v", SD.Diagnostics)
+	}
+
+	// каждая неправильная последовательность UTF-8 даёт свою ошибку
+	R := NewBytesReader([]byte("А = \xFF\nБ = \xFE"))
+	R.UTF8Mode = UTF8Strict
+	SD, E = TranslateReader(R)
+	if !errors.Is(E, EInvalidUTF8) || len(SD.Diagnostics) != 2 ||
+		SD.Diagnostics[1].Code != EInvalidUTF8.Code ||
+		SD.Diagnostics[1].Span.Start.LineNo != 1 {
+		t.Errorf("Ожидается две ошибки EInvalidUTF8, получено: %v", SD.Diagnostics)
+	}
+}
+
+func TestSyntaxSpans(t *testing.T) {
+	sd, E := TranslateReader(NewBytesReader(
+		[]byte("если А = 1\n  Б += вызов(В, 42)\n")))
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+
+	I := sd.Program.List[0].(*TIfStmt)
+	A := I.Then.(*TAssignStmt)
+	C := A.Value.(*TBinaryExpr).Y.(*TCallExpr)
+
+	spans := []struct {
+		N                                TNode
+		Line, Column, EndLine, EndColumn uint
+	}{
+		{I, 0, 0, 1, 19}, {I.Cond, 0, 5, 0, 10}, {A, 1, 2, 1, 19},
+		{A.Target, 1, 2, 1, 3}, {C, 1, 7, 1, 19}, {C.Args[1], 1, 16, 1, 18},
+		{sd.Program, 0, 0, 1, 19},
+	}
+	for i, S := range spans {
+		span := S.N.Span()
+		if span.Start.LineNo != S.Line || span.Start.ColumnNo != S.Column ||
+			span.End.LineNo != S.EndLine || span.End.ColumnNo != S.EndColumn {
+			t.Errorf("Узел № %d: участок [%d:%d]-[%d:%d], ожидается [%d:%d]-[%d:%d]",
+				i, span.Start.LineNo, span.Start.ColumnNo, span.End.LineNo,
+				span.End.ColumnNo, S.Line, S.Column, S.EndLine, S.EndColumn)
+		}
+	}
+
+	// элементы языка указывают на свои лексемы: 'если' и '+='
+	items := sd.LanguageItems
+	if items[0].Type != ltitIf || items[0].Span.End.ColumnNo != 4 {
+		t.Errorf("Элемент 'если': %+v", items[0])
+	}
+	for _, item := range items {
+		if item.Type == ltitAssignment && (item.Span.Start.LineNo != 1 ||
+			item.Span.Start.ColumnNo != 4 || item.Span.End.ColumnNo != 6) {
+			t.Errorf("Элемент присваивания: %+v", item)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	S := "функция Ф(А: целое)\n" +
+		"начало\n" +
+		"  Б = (1\n" +
+		"  В = 2 +\n" +
+		"  если Г = ) начало\n" +
+		"    Д = 1\n" +
+		"  конец\n" +
+		"  Е = 3\n" +
+		"конец\n" +
+		"функция Ж()\n" +
+		"начало\n" +
+		"  З = 4 )\n" +
+		"конец"
+	sd, E := TranslateReader(NewBytesReader([]byte(S)))
+	if !errors.Is(E, ETooMuchOpenRB) {
+		t.Errorf("Ожидается первая ошибка ETooMuchOpenRB, получено: %v", E)
+	}
+
+	standard := []struct {
+		E                *lsaError
+		LineNo, ColumnNo uint
+	}{
+		{ETooMuchOpenRB, 2, 8},
+		{EExpectedArgument, 3, 9},
+		{EExpectedArgument, 4, 11},
+		{ETooMuchCloseRB, 11, 8},
+	}
+	if len(sd.Diagnostics) != len(standard) {
+		t.Fatalf("Получено сообщений: %v, ожидается %d", sd.Diagnostics,
+			len(standard))
+	}
+	for i, D := range sd.Diagnostics {
+		N := standard[i]
+		if D.Severity != SeverityError || D.Code != N.E.Code ||
+			D.Span.Start.LineNo != N.LineNo || D.Span.Start.ColumnNo != N.ColumnNo {
+			t.Errorf("Сообщение %d: %v, ожидается [%d:%d] %s", i, D,
+				N.LineNo, N.ColumnNo, N.E.Code)
+		}
+	}
+
+	// после ошибок переводятся обе функции и оператор Е = 3
+	if len(sd.Program.List) != 2 {
+		t.Fatalf("Получено операторов: %d, ожидается 2", len(sd.Program.List))
+	}
+	F := sd.Program.List[0].(*TFuncDecl)
+	if B := F.Body.(*TBlockStmt); len(B.List) != 1 {
+		t.Errorf("В теле функции %d операторов, ожидается 1", len(B.List))
+	}
+
+	// незакрытый блок
+	sd, E = TranslateReader(NewBytesReader([]byte("А = 1\n{\n  Б = 2\n")))
+	if !errors.Is(E, EExpectedCloseOper) {
+		t.Fatalf("Ожидается ошибка EExpectedCloseOper, получено: %v", E)
+	}
+	D := sd.Diagnostics[0]
+	if len(D.Notes) != 1 || D.Notes[0].Msg != "[1:0] здесь начинается блок" {
+		t.Errorf("Пояснения к ошибке: %v", D.Notes)
+	}
+}
+
+func TestConcurrentErrors(t *testing.T) {
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+	for i := range errs {
+		wg.Add(1)
+		go func(AIndex int) {
+			defer wg.Done()
+			S := strings.Repeat("\n", AIndex) + "А = (Б + 1"
+			_, errs[AIndex] = TranslateReader(NewBytesReader([]byte(S)))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, E := range errs {
+		if !errors.Is(E, ETooMuchOpenRB) || ErrorCode(E) != "E205" {
+			t.Fatalf("Текст %d: ожидается ошибка ETooMuchOpenRB, получено: %v", i, E)
+		}
+		if lsaE := E.(*lsaError); lsaE.LineNo != uint(i) || lsaE.ColumnNo != 10 {
+			t.Errorf("Текст %d: ошибка в [%d:%d]", i, lsaE.LineNo, lsaE.ColumnNo)
+		}
+	}
+	if ETooMuchOpenRB.LineNo != 0 || ETooMuchOpenRB.ColumnNo != 0 {
+		t.Error("Изменена ошибка пакета ETooMuchOpenRB")
+	}
+	if errors.Is(errs[0], ETooMuchCloseRB) || ErrorCode(io.EOF) != "" {
+		t.Error("Ошибки с разными кодами не должны совпадать")
+	}
+}
+
+func TestRenderDiagnostics(t *testing.T) {
+	S := "А = 1\r\n{\r\n\tБ = (2\r\n\tВ = 3\r\n"
+	R := NewBytesReader([]byte(S))
+	R.TabWidth = 4
+	sd, _ := TranslateReader(R)
+
+	render := TRenderer{FileName: "проба.l", Source: R.SourceText(), TabWidth: 4}
+	var B strings.Builder
+	if E := render.RenderAll(&B, sd.Diagnostics); E != nil {
+		t.Fatal(E.Error())
+	}
+	standard := "ошибка[E205]: Слишком много (\n" +
+		" --> проба.l:3:11\n" +
+		"  |\n" +
+		"3 |     Б = (2\n" +
+		"  |           ^\n" +
+		"\n" +
+		"ошибка[E206]: Отсутствует 'конец'\n" +
+		" --> проба.l:5:1\n" +
+		"  |\n" +
+		"2 | {\n" +
+		"  | - здесь начинается блок\n" +
+		"5 | \n" +
+		"  | ^\n" +
+		"  = примечание: [1:0] здесь начинается блок\n"
+	if B.String() != standard {
+		t.Errorf("Получено:\n%s\nожидается:\n%s", B.String(), standard)
+	}
+
+	B.Reset()
+	render.Colors = true
+	render.Render(&B, sd.Diagnostics[0])
+	if !strings.HasPrefix(B.String(), ansiRed+"ошибка[E205]"+ansiReset) {
+		t.Errorf("Нет цвета: %q", B.String())
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	sd, _ := TranslateReader(NewBytesReader([]byte("А = Б +")))
+	var B strings.Builder
+	if E := RenderJSON(&B, "проба.l", sd.Diagnostics); E != nil {
+		t.Fatal(E.Error())
+	}
+
+	var report struct {
+		File        string
+		Diagnostics []struct {
+			Severity string
+			Code     string
+			Message  string
+			Span     struct {
+				Start, End struct{ Line, Column, Offset uint }
+			}
+		}
+	}
+	if E := json.Unmarshal([]byte(B.String()), &report); E != nil {
+		t.Fatalf("%v:\n%s", E, B.String())
+	}
+	if report.File != "проба.l" || len(report.Diagnostics) != 1 {
+		t.Fatalf("Получено:\n%s", B.String())
+	}
+	D := report.Diagnostics[0]
+	if D.Severity != "error" || D.Code != EExpectedArgument.Code ||
+		D.Message != EExpectedArgument.Msg || D.Span.Start.Column != 7 ||
+		D.Span.Start.Offset != 9 {
+		t.Errorf("Получено:\n%s", B.String())
+	}
+
+	B.Reset()
+	RenderJSON(&B, "", nil)
+	if B.String() != "{\n  \"diagnostics\": []\n}\n" {
+		t.Errorf("Пустой список: %q", B.String())
+	}
+}
+
+func TestMessageCatalogue(t *testing.T) {
+	for code, texts := range messageCatalogue {
+		if texts[LanguageRussian] == "" || texts[LanguageEnglish] == "" {
+			t.Errorf("%s: нет перевода", code)
+		}
+		if strings.Count(texts[0], "%") != strings.Count(texts[1], "%") {
+			t.Errorf("%s: разное число подстановок в переводах", code)
+		}
+	}
+
+	errs := []*lsaError{EUnterminatedString, EUnterminatedChar, EInvalidNumber,
+		ENumberOverflow, EInvalidEscape, ECharLength, EUnterminatedComment,
+		EInvalidUTF8, EUnknownEncoding, EExpectedExpression, ESyntaxError,
+		EExpectedArgument, ETooMuchCloseRB, ETooMuchOpenRB, EExpectedCloseOper,
+		EUnExpectedKeyword, EExpectedType, EExpectedParamName,
+		EExpectedParamType, EExpectedCloseRB, EExpectedVarName, EExpectedIdent,
+		EExpectedVarType, EGenNestedFunction, EGenUnknownNode,
+		EGenUnknownOperation, EGenNumberTooBig, EUnknownKeywords, EKeywordFile,
+		EKeywordConflict, EReturnOutsideFunction, EProcedureReturnsValue,
+		EProcedureResult, EMissingReturn, EExpectedFrom, EExpectedTo,
+		ENonPositiveStep, EExpectedUntil, EWhileNeedsBlock}
+	codes := map[string]bool{}
+	for _, E := range errs {
+		if _, ok := messageCatalogue[E.Code]; !ok || codes[E.Code] {
+			t.Errorf("%s: код отсутствует в каталоге или повторяется", E.Code)
+		}
+		codes[E.Code] = true
+	}
+
+	if L, ok := LanguageByName(" English "); !ok || L != LanguageEnglish {
+		t.Error("Не найден язык English")
+	}
+	if _, ok := LanguageByName("klingon"); ok {
+		t.Error("Найден неизвестный язык")
+	}
+	if S := Message("W201", LanguageEnglish, "42"); S != "Lexeme skipped: 42" {
+		t.Errorf("Сообщение W201: %q", S)
+	}
+	if S := Message("X999", LanguageEnglish); S != "X999" {
+		t.Errorf("Неизвестный код: %q", S)
+	}
+
+	_, E := TranslateReader(NewBytesReader([]byte("А = Б +")))
+	if S := ErrorMessage(E, LanguageEnglish); S != "Operand expected" {
+		t.Errorf("Текст ошибки: %q", S)
+	}
+	if S := ErrorMessage(E, LanguageRussian); S != "Ожидается операнд" {
+		t.Errorf("Текст ошибки: %q", S)
+	}
+
+	sd, _ := TranslateReader(NewBytesReader([]byte("{\n  42\n")))
+	render := TRenderer{Source: "{\n  42\n", Language: LanguageEnglish}
+	var B strings.Builder
+	render.RenderAll(&B, sd.Diagnostics)
+	standard := "warning[W201]: Lexeme skipped: 42\n" +
+		" --> 2:3\n" +
+		"  |\n" +
+		"2 |   42\n" +
+		"  |   ^^\n" +
+		"\n" +
+		"error[E206]: Missing 'end'\n" +
+		" --> 3:1\n" +
+		"  |\n" +
+		"1 | {\n" +
+		"  | - block starts here\n" +
+		"3 | \n" +
+		"  | ^\n" +
+		"  = note: [0:0] block starts here\n"
+	if B.String() != standard {
+		t.Errorf("Получено:\n%s\nожидается:\n%s", B.String(), standard)
+	}
+	if sd.Diagnostics[0].Msg != "Лексема пропущена: 42" {
+		t.Errorf("Изменено исходное сообщение: %q", sd.Diagnostics[0].Msg)
+	}
+}
+
+func TestKeywordSets(t *testing.T) {
+	translate := func(S string) (TSyntaxDescriptor, error) {
+		return TranslateReader(NewBytesReader([]byte(S)))
+	}
+	isIf := func(sd TSyntaxDescriptor) bool {
+		if len(sd.Program.List) != 1 {
+			return false
+		}
+		_, ok := sd.Program.List[0].(*TIfStmt)
+		return ok
+	}
+
+	texts := []string{
+		"если А = 1 начало Б = 2 конец",
+		"if А = 1 begin Б = 2 end",
+		"//# слова = русский\nесли А = 1 начало Б = 2 конец",
+		"//# keywords = English\nif А = 1 begin Б = 2 end",
+		"// украинский\n//# слова = українська\nякщо А = 1 початок Б = 2 кінець",
+		"//# слова = қазақша\nегер А = 1 басы Б = 2 соңы",
+	}
+	for _, S := range texts {
+		if sd, E := translate(S); E != nil || !isIf(sd) {
+			t.Errorf("%q: %v", S, E)
+		}
+	}
+
+	// в украинском и казахском наборах есть слово для каждого понятия
+	for _, list := range [][]TKeyword{ukrainianKeywords, kazakhKeywords} {
+		words := map[TKeywordId]bool{}
+		for _, K := range list {
+			if !isCyrillicWord(K.Name) {
+				t.Errorf("Слово не на кириллице: %s", K.Name)
+			}
+			words[K.Id] = true
+		}
+		for concept, id := range keywordConcepts {
+			if !words[id] && id != kwiDownTo && id != kwiUntil {
+				t.Errorf("Нет слова для понятия '%s' в наборе %s", concept,
+					list[0].Name)
+			}
+		}
+	}
+	loops := []struct{ Text, Tree string }{
+		{"//# слова = украинский\nдля І від 9 вниз до 0 {}",
+			"(program (for-down І 9 0 (block)))"},
+		{"//# слова = казахский\nүшін І бастап 9 төмен дейін 0 {}",
+			"(program (for-down І 9 0 (block)))"},
+		{"//# слова = украинский\nповторювати\n  Ф()\nдо Г",
+			"(program (repeat-until (block (call Ф)) Г))"},
+		{"//# слова = казахский\nқайталау\n  Ф()\nдейін Г",
+			"(program (repeat-until (block (call Ф)) Г))"},
+	}
+	for _, T := range loops {
+		if sd, E := translate(T.Text); E != nil || nodeToString(sd.Program) != T.Tree {
+			t.Errorf("%q: %s, %v", T.Text, nodeToString(sd.Program), E)
+		}
+	}
+
+	// в английском наборе 'если' — обычное слово
+	sd, E := translate("//# слова = english\nесли А = 1")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	if A, ok := sd.Program.List[0].(*TAssignStmt); !ok || A.Target.Name != "если А" {
+		t.Errorf("Получено: %s", nodeToString(sd.Program))
+	}
+
+	if _, E = translate("//# слова = klingon\nА = 1"); !errors.Is(E, EUnknownKeywords) {
+		t.Errorf("Ожидается ошибка EUnknownKeywords, получено: %v", E)
+	}
+	// прагма после первой лексемы не действует
+	if _, E = translate("А = 1\n//# слова = klingon\nБ = 2"); E != nil {
+		t.Errorf("Прагма после лексемы: %v", E)
+	}
+
+	set, E := LoadKeywordSet(strings.NewReader("# проба\n" +
+		"название = проба, test\n" +
+		"function = фн\n" +
+		"начало = {{, нач\n" +
+		"конец = кон\n" +
+		"if = коли\n"))
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	RegisterKeywordSet(set)
+	if KeywordSetByName("TEST") != set {
+		t.Error("Набор не зарегистрирован")
+	}
+	sd, E = translate("//# keywords = проба\nфн Ф() нач коли А = 1 нач кон кон")
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	if F, ok := sd.Program.List[0].(*TFuncDecl); !ok || F.Name.Name != "Ф" {
+		t.Errorf("Получено: %s", nodeToString(sd.Program))
+	}
+
+	_, E = LoadKeywordSet(strings.NewReader("название = ошибка\n\nцикл = пока\n"))
+	if !errors.Is(E, EKeywordFile) || E.(*lsaError).LineNo != 2 {
+		t.Errorf("Ожидается ошибка EKeywordFile в строке 2, получено: %v", E)
+	}
+	if set.Add("неизвестно", "слово") {
+		t.Error("Добавлено неизвестное понятие")
+	}
+
+	R := NewBytesReader([]byte("//# слова = english\nif А = 1 begin end"))
+	L, E := R.BuildLexems()
+	if E != nil {
+		t.Fatal(E.Error())
+	}
+	if sd, E = TranslateCodeWith(L, R.Keywords); E != nil || !isIf(sd) {
+		t.Errorf("TranslateCodeWith: %v", E)
+	}
+}
+
+func TestConvertKeywords(t *testing.T) {
+	convert := func(S, ATarget string) (string, error) {
+		R, E := ConvertKeywords([]byte(S), KeywordSetByName(ATarget))
+		return string(R), E
+	}
+
+	source := "func Сумма(А: целый): целый {\n" +
+		"  // комментарий: if\n" +
+		"  if А > 0 begin  Б = А end иначе{Б = 0}\n" +
+		"  return Б\n" +
+		"}\n"
+	tests := []struct{ target, result string }{
+		{"русский", "функция Сумма(А: целый): целый начало\n" +
+			"  // комментарий: if\n" +
+			"  если А > 0 начало  Б = А конец иначе начало Б = 0 конец\n" +
+			"  вернуть Б\n" +
+			"конец\n"},
+		{"english", "function Сумма(А: целый): целый begin\n" +
+			"  // комментарий: if\n" +
+			"  if А > 0 begin  Б = А end else begin Б = 0 end\n" +
+			"  return Б\n" +
+			"end\n"},
+		{"ukrainian", "//# слова = украинский\n" +
+			"функція Сумма(А: целый): целый початок\n" +
+			"  // комментарий: if\n" +
+			"  якщо А > 0 початок  Б = А кінець інакше початок Б = 0 кінець\n" +
+			"  повернути Б\n" +
+			"кінець\n"},
+	}
+	for _, T := range tests {
+		S, E := convert(source, T.target)
+		if E != nil {
+			t.Fatal(E.Error())
+		}
+		if S != T.result {
+			t.Errorf("%s, получено:\n%s\nожидается:\n%s", T.target, S, T.result)
+		}
+		// обратное преобразование даёт тот же перевод
+		if _, E = TranslateReader(NewBytesReader([]byte(S))); E != nil {
+			t.Errorf("%s: %v", T.target, E)
+		}
+	}
+
+	// в русском наборе нет слова для downto
+	S, E := convert("for i = 9 downto 0 {}", "русский")
+	if standard := "для i = 9 вниз до 0 начало конец"; E != nil || S != standard {
+		t.Errorf("Получено: %q, %v", S, E)
+	}
+	S, E = convert("Расстояние до цели = 5\nдля к от 1 до 2 {}", "english")
+	if standard := "Расстояние до цели = 5\nfor к from 1 to 2 begin end"; E != nil ||
+		S != standard {
+		t.Errorf("Получено: %q, %v", S, E)
+	}
+	S, E = convert("Расстояние до цели = 5", "русский")
+	if E != nil || S != "Расстояние до цели = 5" {
+		t.Errorf("Получено: %q, %v", S, E)
+	}
+	S, E = convert("и = А и Б", "english")
+	if E != nil || S != "и = А and Б" {
+		t.Errorf("Получено: %q, %v", S, E)
+	}
+	// перевод оператора с ошибкой остановился на ')'
+	S, E = convert("и = А ) и Б или (и)\nВ = 1 сдвл 2", "english")
+	if standard := "и = А ) and Б or (и)\nВ = 1 shl 2"; E != nil || S != standard {
+		t.Errorf("Получено: %q, %v", S, E)
+	}
+	S, E = convert("повторять\n  для К от 1 до 2 {}\nдо Икс > 10", "english")
+	if standard := "repeat\n  for К from 1 to 2 begin end\nuntil Икс > 10"; E != nil ||
+		S != standard {
+		t.Errorf("Получено: %q, %v", S, E)
+	}
+	S, E = convert("do { Икс = 1 } while Икс < 10", "русский")
+	if standard := "повторять начало Икс = 1 конец пока Икс < 10"; E != nil ||
+		S != standard {
+		t.Errorf("Получено: %q, %v", S, E)
+	}
+	S, E = convert("repeat\n  i = i + 1\nuntil i > 9", "русский")
+	if standard := "повторять\n  i = i + 1\nдо i > 9"; E != nil || S != standard {
+		t.Errorf("Получено: %q, %v", S, E)
+	}
+
+	// прагма получает название нового набора
+	S, E = convert("//# слова = english\nif А begin end", "русский")
+	if standard := "//# слова = русский\nесли А начало конец"; E != nil || S != standard {
+		t.Errorf("Получено: %q, %v", S, E)
+	}
+
+	// в английском наборе 'если' — имя переменной, в русском — нет
+	_, E = convert("//# слова = english\nА =\n если", "русский")
+	if !errors.Is(E, EKeywordConflict) || E.(*lsaError).LineNo != 2 ||
+		E.(*lsaError).ColumnNo != 1 {
+		t.Errorf("Ожидается ошибка EKeywordConflict, получено: %v", E)
+	}
+
+	// текст в windows-1251 возвращается в UTF-8
+	data := append([]byte("//# кодировка = windows-1251\n"),
+		0xE5, 0xF1, 0xEB, 0xE8, ' ', 0xC0, ' ', 0xED, 0xE0, 0xF7, 0xE0, 0xEB,
+		0xEE, ' ', 0xEA, 0xEE, 0xED, 0xE5, 0xF6)
+	if S, E = convert(string(data), "english"); E != nil ||
+		S != "//# кодировка = utf-8\nif А begin end" {
+		t.Errorf("Получено: %q, %v", S, E)
+	}
+}